@@ -2,23 +2,37 @@ package api
 
 import (
 	"adapter/internal/ebpf"
+	"adapter/internal/events"
+	"adapter/internal/exporter"
 	"adapter/prometheus"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type RegisterRequest struct {
-	Name   string   `json:"name"`
-	Help   string   `json:"help"`
-	Type   string   `json:"type"` // "counter" or "gauge"
-	Labels []string `json:"labels"`
-	Path   string   `json:"path"`
+	Name        string          `json:"name"`
+	Help        string          `json:"help"`
+	Type        string          `json:"type"` // "counter", "gauge" or "histogram"
+	Labels      []string        `json:"labels"`
+	Path        string          `json:"path"`
+	KeyFields   []string        `json:"keyFields"`   // BTF key fields used as label values
+	Metrics     []ebpf.Metric   `json:"metrics"`     // BTF value fields exported as metrics
+	Aggregation string          `json:"aggregation"` // Per-CPU reducer: sum, max, min, avg, or cpu for a cpu label
+	Histogram   *ebpf.Histogram `json:"histogram"`   // Bucket layout when type is Histogram
+	Events      *ebpf.Events    `json:"events"`      // Set when path is a ring buffer or perf event array
+	Interval    string          `json:"interval"`    // Background read interval such as "30s", empty to read on scrape
+	Timeout     string          `json:"timeout"`     // Limit of a single map read
 }
 
-func StartServer() {
-	http.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
+// NewHandler returns the handler of the registration API and the health probes
+func NewHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
 			return
@@ -28,21 +42,35 @@ func StartServer() {
 			http.Error(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
 			return
 		}
-		err := ebpf.AddProgram(req.Name, req.Path, req.Type)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to register program: %v", err), http.StatusInternalServerError)
+		program := ebpf.EBPFProgram{
+			Name:        req.Name,
+			Path:        req.Path,
+			Type:        req.Type,
+			Help:        req.Help,
+			Labels:      req.Labels,
+			KeyFields:   req.KeyFields,
+			Metrics:     req.Metrics,
+			Aggregation: req.Aggregation,
+			Histogram:   req.Histogram,
+			Events:      req.Events,
+			Interval:    req.Interval,
+			Timeout:     req.Timeout,
 		}
-		err = prometheus.RegisterMetric(req.Name, req.Help, req.Type, req.Labels)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Register error: %v", err), http.StatusInternalServerError)
+		if err := program.Validate(); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid registration: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := register(program); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		saveState()
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("registered"))
 	})
 
 	// Query all registered eBPF programs
-	http.HandleFunc("/programs", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/programs", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
 			return
@@ -57,7 +85,7 @@ func StartServer() {
 	})
 
 	// Query specific eBPF program
-	http.HandleFunc("/program/", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/program/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
 			return
@@ -76,8 +104,54 @@ func StartServer() {
 		}
 	})
 
-	// Delete eBPF program
-	http.HandleFunc("/unregister", func(w http.ResponseWriter, r *http.Request) {
+	// Stream the decoded records of an event program as server-sent events
+	mux.HandleFunc("/events/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Only GET allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		programName := strings.TrimPrefix(r.URL.Path, "/events/")
+		if programName == "" {
+			http.Error(w, "Program name is required", http.StatusBadRequest)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		records, cancel, err := events.Subscribe(programName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		defer cancel()
+		// Streams outlive the server's write timeout
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			fmt.Printf("Failed to clear write deadline of event stream: %v\n", err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case record, ok := <-records:
+				if !ok {
+					return
+				}
+				fmt.Fprintf(w, "data: %s\n\n", record)
+				flusher.Flush()
+			}
+		}
+	})
+
+	// Delete eBPF program. Only the program's metrics, exporter and event
+	// streams are dropped; the pinned maps belong to the Loader and are
+	// released by its /unload.
+	mux.HandleFunc("/unregister", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodDelete {
 			http.Error(w, "Only DELETE allowed", http.StatusMethodNotAllowed)
 			return
@@ -95,13 +169,132 @@ func StartServer() {
 			http.Error(w, "Program name is required", http.StatusBadRequest)
 			return
 		}
-		// Remove eBPF program
-		ebpf.RemoveProgram(req.Name)
-		// Remove related Prometheus metrics
+		unregister(req.Name)
+		saveState()
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("unregistered"))
 	})
 
-	fmt.Println("API Loader started on :8080")
-	http.ListenAndServe(":8080", nil)
+	// Liveness only needs the process to answer
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+
+	// Readiness waits for the saved registrations and fails again on shutdown
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !ready.Load() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+
+	return mux
+}
+
+// ready is reported by /readyz
+var ready atomic.Bool
+
+// SetReady sets the state reported by /readyz
+func SetReady(r bool) {
+	ready.Store(r)
+}
+
+// Restore registers the programs saved in the state file by an earlier run.
+// Programs that fail to register are logged and skipped.
+func Restore() {
+	programs, err := ebpf.LoadState()
+	if err != nil {
+		fmt.Printf("Failed to load state: %v\n", err)
+		return
+	}
+	for _, program := range programs {
+		if err := program.Validate(); err != nil {
+			fmt.Printf("Skipping saved program %s: %v\n", program.Name, err)
+			continue
+		}
+		if err := register(program); err != nil {
+			fmt.Printf("Failed to restore program %s: %v\n", program.Name, err)
+			continue
+		}
+		fmt.Printf("Restored program %s\n", program.Name)
+	}
+}
+
+// registerMu serializes changes to the registrations, so a replacement is not
+// interleaved with another change of the same program
+var registerMu sync.Mutex
+
+// register starts exporting a validated program. Registering an existing
+// name replaces it; if the new definition fails to start, the previous one is
+// registered again.
+func register(program ebpf.EBPFProgram) error {
+	registerMu.Lock()
+	defer registerMu.Unlock()
+	previous, replaced := ebpf.GetProgram(program.Name)
+	stop(program.Name)
+	err := start(program)
+	if err == nil || !replaced {
+		return err
+	}
+	if rerr := start(previous); rerr != nil {
+		return fmt.Errorf("%w; previous registration could not be restored: %v", err, rerr)
+	}
+	return err
+}
+
+// start exports a program that is not registered yet
+func start(program ebpf.EBPFProgram) error {
+	if err := ebpf.AddProgram(program); err != nil {
+		return fmt.Errorf("failed to register program: %w", err)
+	}
+	metrics := make([]prometheus.MetricSpec, 0, len(program.MetricList()))
+	for _, metric := range program.MetricList() {
+		metrics = append(metrics, prometheus.MetricSpec{Name: metric.Name, Help: metric.Help, Type: metric.Type})
+	}
+	if program.Events != nil {
+		if err := events.Start(program); err != nil {
+			ebpf.RemoveProgram(program.Name)
+			return fmt.Errorf("failed to consume events: %w", err)
+		}
+	}
+	if program.ReadInterval() > 0 {
+		if err := exporter.Start(program); err != nil {
+			events.Stop(program.Name)
+			ebpf.RemoveProgram(program.Name)
+			return fmt.Errorf("failed to schedule reads: %w", err)
+		}
+	}
+	if err := prometheus.RegisterProgram(program.Name, metrics, program.MetricLabelNames(), exporter.Source(program)); err != nil {
+		exporter.Stop(program.Name)
+		events.Stop(program.Name)
+		ebpf.RemoveProgram(program.Name)
+		return fmt.Errorf("failed to register metrics: %w", err)
+	}
+	return nil
+}
+
+// saveState persists the registry. A failure only costs the registrations on
+// the next restart, so the request still succeeds.
+func saveState() {
+	if err := ebpf.SaveState(); err != nil {
+		fmt.Printf("Failed to save state: %v\n", err)
+	}
+}
+
+// unregister stops exporting a program and forgets it
+func unregister(name string) {
+	registerMu.Lock()
+	defer registerMu.Unlock()
+	stop(name)
+}
+
+// stop stops exporting a program and forgets it
+func stop(name string) {
+	prometheus.UnregisterProgram(name)
+	exporter.Stop(name)
+	events.Stop(name)
+	ebpf.RemoveProgram(name)
 }
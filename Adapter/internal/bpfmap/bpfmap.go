@@ -0,0 +1,266 @@
+package bpfmap
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+)
+
+// batchSize is the number of entries fetched per BatchLookup call
+const batchSize = 256
+
+// Entry is a raw key/value pair read from a map.
+// Values holds one value per possible CPU for per-CPU maps and a single value otherwise.
+type Entry struct {
+	Key    []byte
+	Values [][]byte
+}
+
+// Dump is the content of a map together with its BTF key and value types.
+// KeyType and ValueType are nil when the map was created without BTF.
+type Dump struct {
+	MapID     ebpf.MapID // Changes when the map is recreated, e.g. on program reload
+	KeyType   btf.Type
+	ValueType btf.Type
+	PerCPU    bool
+	Entries   []Entry
+}
+
+// ReadPinnedMap reads every entry of the map pinned at path.
+// Entries are fetched with BatchLookup where the kernel supports it and with
+// the map iterator otherwise.
+func ReadPinnedMap(path string) (*Dump, error) {
+	m, err := ebpf.LoadPinnedMap(path, &ebpf.LoadPinOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pinned map %s: %w", path, err)
+	}
+	defer m.Close()
+	dump := &Dump{PerCPU: isPerCPU(m.Type())}
+	cpus := 1
+	if dump.PerCPU {
+		if cpus, err = ebpf.PossibleCPU(); err != nil {
+			return nil, fmt.Errorf("failed to get possible CPUs: %w", err)
+		}
+	}
+	info, err := m.Info()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get info of map %s: %w", path, err)
+	}
+	dump.MapID, _ = info.ID()
+	dump.KeyType, dump.ValueType, err = mapTypes(info, filepath.Base(path))
+	if err != nil {
+		// Fall back to decoding the raw bytes
+		fmt.Printf("No BTF for map %s: %v\n", path, err)
+	}
+	dump.Entries, err = batchRead(m, cpus)
+	if err == nil {
+		return dump, nil
+	}
+	dump.Entries, err = iterRead(m, cpus)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read map %s: %w", path, err)
+	}
+	return dump, nil
+}
+
+// mapTypes looks up the key and value types of a map in the BTF of the object
+// that created it. BTF-defined maps are described by a variable of the same
+// name in the .maps section whose key and value members point at the types.
+func mapTypes(info *ebpf.MapInfo, name string) (btf.Type, btf.Type, error) {
+	id, ok := info.BTFID()
+	if !ok {
+		return nil, nil, errors.New("map has no BTF")
+	}
+	spec, err := loadBTF(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	var maps *btf.Datasec
+	if err := spec.TypeByName(".maps", &maps); err != nil {
+		return nil, nil, fmt.Errorf("no .maps section: %w", err)
+	}
+	for _, v := range maps.Vars {
+		variable, ok := v.Type.(*btf.Var)
+		if !ok || !matchesMapName(variable.Name, name, info.Name) {
+			continue
+		}
+		def, ok := btf.UnderlyingType(variable.Type).(*btf.Struct)
+		if !ok {
+			return nil, nil, fmt.Errorf("map definition of %s is not a struct", variable.Name)
+		}
+		var key, value btf.Type
+		for _, member := range def.Members {
+			ptr, ok := member.Type.(*btf.Pointer)
+			if !ok {
+				continue
+			}
+			switch member.Name {
+			case "key":
+				key = ptr.Target
+			case "value":
+				value = ptr.Target
+			}
+		}
+		if key == nil || value == nil {
+			return nil, nil, fmt.Errorf("map definition of %s has no key or value type", variable.Name)
+		}
+		return key, value, nil
+	}
+	return nil, nil, fmt.Errorf("map %s not found in BTF", name)
+}
+
+// EventType looks up the named record type of the ring buffer or perf event
+// array pinned at path. Those maps usually carry no BTF of their own, so the
+// BTF of the programs pinned next to them by the Loader is searched as well.
+func EventType(path string, typeName string) (btf.Type, error) {
+	var ids []btf.ID
+	if m, err := ebpf.LoadPinnedMap(path, &ebpf.LoadPinOptions{ReadOnly: true}); err == nil {
+		if info, err := m.Info(); err == nil {
+			if id, ok := info.BTFID(); ok {
+				ids = append(ids, id)
+			}
+		}
+		m.Close()
+	}
+	progPins, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "programs", "*"))
+	for _, pin := range progPins {
+		prog, err := ebpf.LoadPinnedProgram(pin, &ebpf.LoadPinOptions{ReadOnly: true})
+		if err != nil {
+			continue
+		}
+		if info, err := prog.Info(); err == nil {
+			if id, ok := info.BTFID(); ok {
+				ids = append(ids, id)
+			}
+		}
+		prog.Close()
+	}
+	for _, id := range ids {
+		spec, err := loadBTF(id)
+		if err != nil {
+			continue
+		}
+		types, _ := spec.AnyTypesByName(typeName)
+		for _, typ := range types {
+			switch typ.(type) {
+			case *btf.Func, *btf.Var, *btf.Datasec:
+				// A function or variable sharing the record type's name
+				continue
+			}
+			return typ, nil
+		}
+	}
+	return nil, fmt.Errorf("type %s not found in the BTF of %s or its programs", typeName, path)
+}
+
+func loadBTF(id btf.ID) (*btf.Spec, error) {
+	handle, err := btf.NewHandleFromID(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open BTF: %w", err)
+	}
+	defer handle.Close()
+	spec, err := handle.Spec(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse BTF: %w", err)
+	}
+	return spec, nil
+}
+
+// matchesMapName matches a .maps variable against the pin name, or against
+// the kernel map name which is truncated to 15 characters
+func matchesMapName(varName string, pinName string, kernelName string) bool {
+	if varName == pinName || varName == kernelName {
+		return true
+	}
+	return len(kernelName) == 15 && strings.HasPrefix(varName, kernelName)
+}
+
+// batchRead reads m with BatchLookup. Keys and values are read into slices of
+// fixed size byte arrays so the kernel writes straight into them. Per-CPU
+// maps return cpus consecutive values per key.
+func batchRead(m *ebpf.Map, cpus int) ([]Entry, error) {
+	keySize, valueSize := int(m.KeySize()), int(m.ValueSize())
+	keys := byteArrays(keySize, batchSize)
+	values := byteArrays(valueSize, batchSize*cpus)
+
+	var entries []Entry
+	var cursor ebpf.MapBatchCursor
+	for {
+		n, err := m.BatchLookup(&cursor, keys.Interface(), values.Interface(), nil)
+		for i := 0; i < n; i++ {
+			entries = append(entries, Entry{
+				Key:    copyBytes(keys.Index(i), keySize),
+				Values: copyValues(values, i*cpus, cpus, valueSize),
+			})
+		}
+		if errors.Is(err, ebpf.ErrKeyNotExist) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			// Per-CPU batch lookups can swallow errors and return nothing
+			return nil, errors.New("batch lookup returned no entries")
+		}
+	}
+}
+
+// iterRead reads m one entry at a time
+func iterRead(m *ebpf.Map, cpus int) ([]Entry, error) {
+	valueSize := int(m.ValueSize())
+	key := make([]byte, m.KeySize())
+	var entries []Entry
+	iter := m.Iterate()
+	if !isPerCPU(m.Type()) {
+		value := make([]byte, valueSize)
+		for iter.Next(&key, &value) {
+			entries = append(entries, Entry{
+				Key:    append([]byte(nil), key...),
+				Values: [][]byte{append([]byte(nil), value...)},
+			})
+		}
+	} else {
+		values := byteArrays(valueSize, cpus)
+		for iter.Next(&key, values.Interface()) {
+			entries = append(entries, Entry{
+				Key:    append([]byte(nil), key...),
+				Values: copyValues(values, 0, cpus, valueSize),
+			})
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// byteArrays makes a slice of n [size]byte arrays
+func byteArrays(size int, n int) reflect.Value {
+	return reflect.MakeSlice(reflect.SliceOf(reflect.ArrayOf(size, reflect.TypeOf(byte(0)))), n, n)
+}
+
+func copyBytes(array reflect.Value, size int) []byte {
+	return append([]byte(nil), array.Slice(0, size).Bytes()...)
+}
+
+func copyValues(arrays reflect.Value, start int, n int, size int) [][]byte {
+	values := make([][]byte, n)
+	for i := range values {
+		values[i] = copyBytes(arrays.Index(start+i), size)
+	}
+	return values
+}
+
+func isPerCPU(t ebpf.MapType) bool {
+	switch t {
+	case ebpf.PerCPUHash, ebpf.PerCPUArray, ebpf.LRUCPUHash, ebpf.PerCPUCGroupStorage:
+		return true
+	}
+	return false
+}
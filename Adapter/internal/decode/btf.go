@@ -0,0 +1,250 @@
+package decode
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/ebpf/btf"
+)
+
+// Value is a decoded scalar field
+type Value struct {
+	Text    string  // Representation used as a label value
+	Number  float64 // Numeric value, only valid when Numeric is set
+	Numeric bool
+}
+
+// Fields maps dotted field paths such as "conn.daddr" to their decoded values.
+// A scalar key or value is stored under the empty path.
+type Fields map[string]Value
+
+// Decode splits a key or value into fields following its BTF type.
+// Without a type the bytes are decoded as a single scalar.
+func Decode(typ btf.Type, b []byte) (Fields, error) {
+	fields := make(Fields)
+	if typ == nil {
+		v := Value{Text: KeyString(b)}
+		if n, err := Uint(b); err == nil {
+			v.Number, v.Numeric = float64(n), true
+		}
+		fields[""] = v
+		return fields, nil
+	}
+	if err := decodeType(fields, "", typ, b); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// Number returns the numeric value of the named field
+func (f Fields) Number(name string) (float64, error) {
+	v, ok := f[name]
+	if !ok {
+		return 0, fmt.Errorf("field %q not found, available: %v", name, f.Names())
+	}
+	if !v.Numeric {
+		return 0, fmt.Errorf("field %q is not numeric", name)
+	}
+	return v.Number, nil
+}
+
+// Labels returns the text of the named fields in order. Without names the
+// whole key becomes a single label.
+func (f Fields) Labels(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return []string{f.String()}, nil
+	}
+	labels := make([]string, 0, len(names))
+	for _, name := range names {
+		v, ok := f[name]
+		if !ok {
+			return nil, fmt.Errorf("field %q not found, available: %v", name, f.Names())
+		}
+		labels = append(labels, v.Text)
+	}
+	return labels, nil
+}
+
+// Names returns the sorted field paths
+func (f Fields) Names() []string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// String renders a scalar as its text and a struct as "field=value" pairs
+func (f Fields) String() string {
+	if v, ok := f[""]; ok && len(f) == 1 {
+		return v.Text
+	}
+	parts := make([]string, 0, len(f))
+	for _, name := range f.Names() {
+		parts = append(parts, name+"="+f[name].Text)
+	}
+	return strings.Join(parts, ",")
+}
+
+func decodeType(fields Fields, path string, typ btf.Type, b []byte) error {
+	switch t := btf.UnderlyingType(typ).(type) {
+	case *btf.Int:
+		if t.Size > 8 {
+			if int(t.Size) > len(b) {
+				return fmt.Errorf("%s: need %d bytes, have %d", fieldName(path), t.Size, len(b))
+			}
+			fields[path] = Value{Text: "0x" + hex.EncodeToString(b[:t.Size])}
+			return nil
+		}
+		raw, err := readInt(b, int(t.Size))
+		if err != nil {
+			return fmt.Errorf("%s: %w", fieldName(path), err)
+		}
+		if t.Encoding == btf.Signed {
+			fields[path] = signedValue(raw, int(t.Size))
+		} else {
+			fields[path] = unsignedValue(raw)
+		}
+	case *btf.Enum:
+		raw, err := readInt(b, int(t.Size))
+		if err != nil {
+			return fmt.Errorf("%s: %w", fieldName(path), err)
+		}
+		v := unsignedValue(raw)
+		if t.Signed {
+			v = signedValue(raw, int(t.Size))
+		}
+		for _, ev := range t.Values {
+			if ev.Value == raw {
+				v.Text = ev.Name
+				break
+			}
+		}
+		fields[path] = v
+	case *btf.Pointer:
+		raw, err := readInt(b, 8)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fieldName(path), err)
+		}
+		fields[path] = Value{Text: "0x" + strconv.FormatUint(raw, 16), Number: float64(raw), Numeric: true}
+	case *btf.Struct:
+		return decodeMembers(fields, path, t.Members, b)
+	case *btf.Union:
+		return decodeMembers(fields, path, t.Members, b)
+	case *btf.Array:
+		return decodeArray(fields, path, t, b)
+	default:
+		size, err := btf.Sizeof(typ)
+		if err != nil || size > len(b) {
+			return fmt.Errorf("%s: cannot decode %v", fieldName(path), typ)
+		}
+		fields[path] = Value{Text: "0x" + hex.EncodeToString(b[:size])}
+	}
+	return nil
+}
+
+func decodeMembers(fields Fields, path string, members []btf.Member, b []byte) error {
+	for _, member := range members {
+		if member.Name == "" && member.BitfieldSize > 0 {
+			// Padding
+			continue
+		}
+		// Anonymous struct and union members are flattened into the parent
+		name := joinPath(path, member.Name)
+		if member.BitfieldSize > 0 {
+			raw, err := readBitfield(b, uint32(member.Offset), uint32(member.BitfieldSize))
+			if err != nil {
+				return fmt.Errorf("%s: %w", fieldName(name), err)
+			}
+			fields[name] = unsignedValue(raw)
+			continue
+		}
+		offset := member.Offset.Bytes()
+		if int(offset) > len(b) {
+			return fmt.Errorf("%s: offset %d is out of range", fieldName(name), offset)
+		}
+		if err := decodeType(fields, name, member.Type, b[offset:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeArray decodes char arrays as strings and other arrays, including
+// __u8 arrays such as addresses, element by element as "name.0", "name.1"
+func decodeArray(fields Fields, path string, t *btf.Array, b []byte) error {
+	elemSize, err := btf.Sizeof(t.Type)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fieldName(path), err)
+	}
+	total := elemSize * int(t.Nelems)
+	if total > len(b) {
+		return fmt.Errorf("%s: need %d bytes, have %d", fieldName(path), total, len(b))
+	}
+	if elem, ok := btf.UnderlyingType(t.Type).(*btf.Int); ok && (elem.Name == "char" || elem.Encoding == btf.Char) {
+		s := b[:total]
+		if i := strings.IndexByte(string(s), 0); i >= 0 {
+			s = s[:i]
+		}
+		fields[path] = Value{Text: string(s)}
+		return nil
+	}
+	for i := 0; i < int(t.Nelems); i++ {
+		if err := decodeType(fields, joinPath(path, strconv.Itoa(i)), t.Type, b[i*elemSize:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readInt(b []byte, size int) (uint64, error) {
+	if size > len(b) {
+		return 0, fmt.Errorf("need %d bytes, have %d", size, len(b))
+	}
+	return Uint(b[:size])
+}
+
+// readBitfield extracts size bits starting at bit offset.
+// Bitfield layout is only handled for little endian machines.
+func readBitfield(b []byte, offset uint32, size uint32) (uint64, error) {
+	start := offset / 8
+	if start >= uint32(len(b)) || size > 57 {
+		return 0, fmt.Errorf("bitfield at bit %d is out of range", offset)
+	}
+	var buf [8]byte
+	copy(buf[:], b[start:])
+	raw := binary.LittleEndian.Uint64(buf[:]) >> (offset % 8)
+	return raw & (1<<size - 1), nil
+}
+
+func unsignedValue(raw uint64) Value {
+	return Value{Text: strconv.FormatUint(raw, 10), Number: float64(raw), Numeric: true}
+}
+
+func signedValue(raw uint64, size int) Value {
+	shift := 64 - 8*size
+	n := int64(raw<<shift) >> shift
+	return Value{Text: strconv.FormatInt(n, 10), Number: float64(n), Numeric: true}
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	if name == "" {
+		return path
+	}
+	return path + "." + name
+}
+
+func fieldName(path string) string {
+	if path == "" {
+		return "value"
+	}
+	return path
+}
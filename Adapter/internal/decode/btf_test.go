@@ -0,0 +1,239 @@
+package decode
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/cilium/ebpf/btf"
+)
+
+var (
+	u8   = &btf.Typedef{Name: "__u8", Type: &btf.Int{Name: "unsigned char", Size: 1}}
+	u16  = &btf.Typedef{Name: "__u16", Type: &btf.Int{Name: "unsigned short", Size: 2}}
+	u32  = &btf.Typedef{Name: "__u32", Type: &btf.Int{Name: "unsigned int", Size: 4}}
+	u64  = &btf.Typedef{Name: "__u64", Type: &btf.Int{Name: "unsigned long long", Size: 8}}
+	s32  = &btf.Int{Name: "int", Size: 4, Encoding: btf.Signed}
+	s16  = &btf.Int{Name: "short", Size: 2, Encoding: btf.Signed}
+	char = &btf.Int{Name: "char", Size: 1, Encoding: btf.Signed}
+)
+
+// bytesOf concatenates native endian encodings of fixed size values
+func bytesOf(values ...any) []byte {
+	var b []byte
+	for _, v := range values {
+		b, _ = binary.Append(b, binary.NativeEndian, v)
+	}
+	return b
+}
+
+// texts returns the label text of every field
+func texts(f Fields) map[string]string {
+	m := make(map[string]string, len(f))
+	for name, v := range f {
+		m[name] = v.Text
+	}
+	return m
+}
+
+func TestDecode(t *testing.T) {
+	ports := &btf.Struct{Name: "ports", Size: 4, Members: []btf.Member{
+		{Name: "sport", Type: u16, Offset: 0},
+		{Name: "dport", Type: u16, Offset: 16},
+	}}
+	tests := []struct {
+		name string
+		typ  btf.Type
+		data []byte
+		want map[string]string
+	}{
+		{
+			name: "no type",
+			data: bytesOf(uint32(42)),
+			want: map[string]string{"": "42"},
+		},
+		{
+			name: "unsigned scalar",
+			typ:  u64,
+			data: bytesOf(uint64(1 << 40)),
+			want: map[string]string{"": "1099511627776"},
+		},
+		{
+			name: "signed int",
+			typ:  s32,
+			data: bytesOf(int32(-7)),
+			want: map[string]string{"": "-7"},
+		},
+		{
+			name: "signed short",
+			typ:  s16,
+			data: bytesOf(int16(-1)),
+			want: map[string]string{"": "-1"},
+		},
+		{
+			name: "nested struct",
+			typ: &btf.Struct{Name: "conn", Size: 12, Members: []btf.Member{
+				{Name: "saddr", Type: u32, Offset: 0},
+				{Name: "ports", Type: ports, Offset: 32},
+				{Name: "pid", Type: u32, Offset: 64},
+			}},
+			data: bytesOf(uint32(1), uint16(443), uint16(8080), uint32(99)),
+			want: map[string]string{"saddr": "1", "ports.sport": "443", "ports.dport": "8080", "pid": "99"},
+		},
+		{
+			name: "anonymous struct member is flattened",
+			typ: &btf.Struct{Name: "key", Size: 8, Members: []btf.Member{
+				{Name: "pid", Type: u32, Offset: 0},
+				{Type: ports, Offset: 32},
+			}},
+			data: bytesOf(uint32(5), uint16(1), uint16(2)),
+			want: map[string]string{"pid": "5", "sport": "1", "dport": "2"},
+		},
+		{
+			name: "union",
+			typ: &btf.Union{Name: "addr", Size: 4, Members: []btf.Member{
+				{Name: "v4", Type: u32, Offset: 0},
+				{Name: "bytes", Type: &btf.Array{Type: u8, Nelems: 4}, Offset: 0},
+			}},
+			data: []byte{10, 0, 0, 1},
+			want: map[string]string{
+				"v4":      "16777226",
+				"bytes.0": "10", "bytes.1": "0", "bytes.2": "0", "bytes.3": "1",
+			},
+		},
+		{
+			name: "bitfields",
+			typ: &btf.Struct{Name: "flags", Size: 4, Members: []btf.Member{
+				{Name: "low", Type: u32, Offset: 0, BitfieldSize: 3},
+				{Type: u32, Offset: 3, BitfieldSize: 5},
+				{Name: "high", Type: u32, Offset: 8, BitfieldSize: 12},
+				{Name: "tail", Type: u8, Offset: 24},
+			}},
+			// low=5, 5 bits of padding set, high=0xabc, tail=7
+			data: bytesOf(uint32(5 | 0x1f<<3 | 0xabc<<8 | 7<<24)),
+			want: map[string]string{"low": "5", "high": "2748", "tail": "7"},
+		},
+		{
+			name: "char array is a string",
+			typ:  &btf.Array{Type: char, Nelems: 8},
+			data: []byte("bash\x00\x00\x00\x00"),
+			want: map[string]string{"": "bash"},
+		},
+		{
+			name: "char array without terminator",
+			typ:  &btf.Array{Type: &btf.Int{Name: "char", Size: 1, Encoding: btf.Char}, Nelems: 4},
+			data: []byte("curl"),
+			want: map[string]string{"": "curl"},
+		},
+		{
+			name: "u8 array is split into elements",
+			typ: &btf.Struct{Name: "mac", Size: 6, Members: []btf.Member{
+				{Name: "addr", Type: &btf.Array{Type: u8, Nelems: 6}, Offset: 0},
+			}},
+			data: []byte{0xde, 0xad, 0xbe, 0xef, 0, 1},
+			want: map[string]string{
+				"addr.0": "222", "addr.1": "173", "addr.2": "190",
+				"addr.3": "239", "addr.4": "0", "addr.5": "1",
+			},
+		},
+		{
+			name: "enum value name",
+			typ: &btf.Enum{Name: "state", Size: 4, Values: []btf.EnumValue{
+				{Name: "TCP_ESTABLISHED", Value: 1},
+				{Name: "TCP_SYN_SENT", Value: 2},
+			}},
+			data: bytesOf(uint32(2)),
+			want: map[string]string{"": "TCP_SYN_SENT"},
+		},
+		{
+			name: "unknown enum value",
+			typ:  &btf.Enum{Name: "state", Size: 4, Values: []btf.EnumValue{{Name: "A", Value: 1}}},
+			data: bytesOf(uint32(9)),
+			want: map[string]string{"": "9"},
+		},
+		{
+			name: "signed enum",
+			typ:  &btf.Enum{Name: "err", Size: 4, Signed: true, Values: []btf.EnumValue{{Name: "OK", Value: 0}}},
+			data: bytesOf(int32(-2)),
+			want: map[string]string{"": "-2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := Decode(tt.typ, tt.data)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if got := texts(fields); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeNumbers(t *testing.T) {
+	typ := &btf.Struct{Name: "val", Size: 12, Members: []btf.Member{
+		{Name: "count", Type: u64, Offset: 0},
+		{Name: "delta", Type: s32, Offset: 64},
+	}}
+	fields, err := Decode(typ, bytesOf(uint64(10), int32(-3)))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	for name, want := range map[string]float64{"count": 10, "delta": -3} {
+		got, err := fields.Number(name)
+		if err != nil || got != want {
+			t.Errorf("Number(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	if _, err := fields.Number("missing"); err == nil {
+		t.Error("Number of a missing field succeeded")
+	}
+
+	name, err := Decode(&btf.Array{Type: char, Nelems: 4}, []byte("sshd"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if _, err := name.Number(""); err == nil {
+		t.Error("Number of a string succeeded")
+	}
+}
+
+func TestDecodeShortBuffer(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  btf.Type
+		data []byte
+	}{
+		{"int", u32, []byte{1, 2}},
+		{"array", &btf.Array{Type: u16, Nelems: 4}, make([]byte, 6)},
+		{"member offset", &btf.Struct{Name: "s", Size: 8, Members: []btf.Member{
+			{Name: "b", Type: u32, Offset: 64},
+		}}, make([]byte, 4)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.typ, tt.data); err == nil {
+				t.Error("Decode succeeded on a short buffer")
+			}
+		})
+	}
+}
+
+func TestFieldsLabels(t *testing.T) {
+	fields := Fields{
+		"pid":  {Text: "42"},
+		"comm": {Text: "bash"},
+	}
+	labels, err := fields.Labels([]string{"comm", "pid"})
+	if err != nil || !reflect.DeepEqual(labels, []string{"bash", "42"}) {
+		t.Errorf("Labels = %v, %v", labels, err)
+	}
+	whole, err := fields.Labels(nil)
+	if err != nil || !reflect.DeepEqual(whole, []string{"comm=bash,pid=42"}) {
+		t.Errorf("Labels(nil) = %v, %v", whole, err)
+	}
+	if _, err := fields.Labels([]string{"uid"}); err == nil {
+		t.Error("Labels of a missing field succeeded")
+	}
+}
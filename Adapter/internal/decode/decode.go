@@ -1,74 +1,66 @@
 package decode
 
 import (
-	"bufio"
-	"encoding/json"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"strconv"
-	"strings"
 )
 
-func ParseBpftoolMapOutput(output string) map[string]uint64 {
-	result := make(map[string]uint64)
-	var entries []struct {
-		Key   string      `json:"key"`
-		Value json.Number `json:"value"`
+// KeyString renders a map key as a label value. Integer sized keys are
+// printed as decimal numbers, NUL padded printable keys as strings and
+// anything else as hex.
+func KeyString(key []byte) string {
+	if s, ok := cString(key); ok {
+		return s
 	}
-	// Ensure the input is a valid JSON array
-	if !strings.HasPrefix(strings.TrimSpace(output), "[") {
-		output = "[" + output
+	switch len(key) {
+	case 1, 2, 4, 8:
+		v, _ := Uint(key)
+		return strconv.FormatUint(v, 10)
 	}
-	if !strings.HasSuffix(strings.TrimSpace(output), "]") {
-		output = output + "]"
-	}
-	err := json.Unmarshal([]byte(output), &entries)
-	if err != nil {
-		// If complete parsing fails, try line-by-line parsing
-		result = parseLineByLine(output)
-	} else {
-		for _, entry := range entries {
-			value, err := entry.Value.Int64()
-			if err != nil {
-				fmt.Printf("Failed to parse value: %v\n", err)
-				continue
-			}
-			result[entry.Key] = uint64(value)
-		}
+	return "0x" + hex.EncodeToString(key)
+}
+
+// Uint reads a 1, 2, 4 or 8 byte native endian unsigned integer
+func Uint(b []byte) (uint64, error) {
+	switch len(b) {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.NativeEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.NativeEndian.Uint32(b)), nil
+	case 8:
+		return binary.NativeEndian.Uint64(b), nil
+	default:
+		return 0, fmt.Errorf("cannot read %d bytes as an integer", len(b))
 	}
-	return result
 }
 
-// parseLineByLine parses the output line by line when JSON parsing fails
-func parseLineByLine(output string) map[string]uint64 {
-	result := make(map[string]uint64)
-	scanner := bufio.NewScanner(strings.NewReader(output))
-	var currentKey string
-	lineCount := 0
-	for scanner.Scan() {
-		lineCount++
-		line := strings.TrimSpace(scanner.Text())
-		if strings.Contains(line, "\"key\":") {
-			keyParts := strings.Split(line, ":")
-			if len(keyParts) >= 2 {
-				keyStr := strings.TrimSpace(keyParts[1])
-				keyStr = strings.Trim(keyStr, "\",")
-				currentKey = keyStr
-			}
+// cString reports whether b is a printable string followed only by NUL padding.
+// Keys shorter than 8 bytes are treated as integers since small numbers are
+// often printable.
+func cString(b []byte) (string, bool) {
+	end := len(b)
+	for i, c := range b {
+		if c == 0 {
+			end = i
+			break
 		}
-		if strings.Contains(line, "\"value\":") && currentKey != "" {
-			valueParts := strings.Split(line, ":")
-			if len(valueParts) >= 2 {
-				valueStr := strings.TrimSpace(valueParts[1])
-				valueStr = strings.TrimRight(valueStr, ",")
-				value, err := strconv.ParseUint(valueStr, 10, 64)
-				if err != nil {
-					continue
-				}
-				result[currentKey] = value
-				currentKey = ""
-			}
+	}
+	if end == 0 || len(b) <= 8 {
+		return "", false
+	}
+	for _, c := range b[:end] {
+		if c < 0x20 || c > 0x7e {
+			return "", false
 		}
 	}
-
-	return result
+	for _, c := range b[end:] {
+		if c != 0 {
+			return "", false
+		}
+	}
+	return string(b[:end]), true
 }
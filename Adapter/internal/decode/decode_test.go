@@ -0,0 +1,71 @@
+package decode
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKeyString(t *testing.T) {
+	tests := []struct {
+		name string
+		key  []byte
+		want string
+	}{
+		{"u8", []byte{7}, "7"},
+		{"u16", bytesOf(uint16(443)), "443"},
+		{"u32", bytesOf(uint32(1234)), "1234"},
+		{"u64", bytesOf(uint64(1 << 33)), "8589934592"},
+		// Small printable integers must not turn into strings
+		{"printable u32", []byte("ab\x00\x00"), "25185"},
+		{"printable u64", []byte("abcdefgh"), "7523094288207667809"},
+		{"padded string", []byte("eth0\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), "eth0"},
+		{"full string", []byte("0123456789"), "0123456789"},
+		{"odd size", []byte{1, 2, 3}, "0x010203"},
+		{"binary", []byte{0xff, 1, 2, 3, 4, 5, 6, 7, 8, 9}, "0xff010203040506070809"},
+		{"data after padding", []byte("eth0\x00\x00\x00\x00x\x00"), "0x65746830000000007800"},
+		{"leading nul", append([]byte{0}, []byte("abcdefghij")...), "0x006162636465666768696a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KeyString(tt.key); got != tt.want {
+				t.Errorf("KeyString(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCString(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want string
+		ok   bool
+	}{
+		{"terminated", []byte("systemd\x00\x00\x00\x00\x00"), "systemd", true},
+		{"unterminated", []byte("kworker/0:1"), "kworker/0:1", true},
+		{"too short", []byte("abc\x00"), "", false},
+		{"eight bytes", []byte("abcdefgh"), "", false},
+		{"empty", make([]byte, 16), "", false},
+		{"control character", []byte("line\nbreak\x00"), "", false},
+		{"garbage after terminator", []byte("name\x00\x00\x00\x00\x00\x01"), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := cString(tt.b)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("cString(%q) = %q, %v, want %q, %v", tt.b, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestUint(t *testing.T) {
+	for _, b := range [][]byte{bytesOf(uint8(200)), bytesOf(uint16(200)), bytesOf(uint32(200)), bytesOf(uint64(200))} {
+		if v, err := Uint(b); err != nil || v != 200 {
+			t.Errorf("Uint(%v) = %d, %v", b, v, err)
+		}
+	}
+	if _, err := Uint(bytes.Repeat([]byte{1}, 3)); err == nil {
+		t.Error("Uint of 3 bytes succeeded")
+	}
+}
@@ -2,14 +2,247 @@ package ebpf
 
 import (
 	"errors"
+	"fmt"
+	"math"
+	"strings"
 	"sync"
+	"time"
 )
 
 type EBPFProgram struct {
-	Name       string `json:"name"`
-	Path       string `json:"path"`
-	Type       string `json:"type"`
-	Promehteus string `json:"promehteus"`
+	Name       string   `json:"name"`
+	Path       string   `json:"path"`
+	Type       string   `json:"type"`
+	Promehteus string   `json:"promehteus"`
+	Help       string   `json:"help,omitempty"`
+	Labels     []string `json:"labels,omitempty"`
+	KeyFields  []string `json:"keyFields,omitempty"` // Key fields exported as labels, in the order of Labels
+	Metrics    []Metric `json:"metrics,omitempty"`   // Value fields exported as metrics
+	// Aggregation reduces the per-CPU values of per-CPU maps: sum (default),
+	// max, min, avg, or cpu to export each CPU with a cpu label
+	Aggregation string `json:"aggregation,omitempty"`
+	// Histogram describes the bucket layout when Type is Histogram
+	Histogram *Histogram `json:"histogram,omitempty"`
+	// Events is set when Path is a ring buffer or perf event array whose
+	// records are counted instead of a map that is read on scrape
+	Events *Events `json:"events,omitempty"`
+	// Interval is how often the map is read in the background, as a Go
+	// duration. When empty the map is read on demand on every scrape.
+	Interval string `json:"interval,omitempty"`
+	// Timeout bounds a single read of the map, DefaultReadTimeout when empty
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// DefaultReadTimeout bounds a map read when the program sets no timeout
+const DefaultReadTimeout = 5 * time.Second
+
+// MinInterval is the shortest background read interval
+const MinInterval = time.Second
+
+// ReadInterval returns the background read interval, zero when the map is read on scrape
+func (p EBPFProgram) ReadInterval() time.Duration {
+	d, _ := time.ParseDuration(p.Interval)
+	return d
+}
+
+// ReadTimeout returns the time a single read of the map may take
+func (p EBPFProgram) ReadTimeout() time.Duration {
+	if d, err := time.ParseDuration(p.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return DefaultReadTimeout
+}
+
+// Events describes the records of a ring buffer or perf event array.
+// Each record increments the program's counters, labelled by KeyFields of the
+// record; a metric with a Field adds up that field instead of counting records.
+type Events struct {
+	RecordType string `json:"recordType,omitempty"` // BTF type name of a record
+	Stream     bool   `json:"stream,omitempty"`     // Expose decoded records on /events/<name>
+}
+
+// HistogramType is the program type whose map holds histogram buckets
+const HistogramType = "Histogram"
+
+// Bucket layouts of histogram maps
+const (
+	BucketsLog2   = "log2"
+	BucketsLinear = "linear"
+)
+
+// Histogram describes a map of bucket counters indexed by slot, as filled by
+// the bcc log2 and linear hist helpers. Slot i of a log2 histogram counts
+// values up to 2^i-1, slot i of a linear histogram values in [Min+i*Step, Min+(i+1)*Step).
+// The exported _sum is read from the map at SumPath and is 0 when no sum map
+// is set, since the bucket counts alone cannot tell it.
+type Histogram struct {
+	Buckets   string  `json:"buckets,omitempty"`   // log2 (default) or linear
+	Min       float64 `json:"min,omitempty"`       // Lower bound of the first linear bucket
+	Step      float64 `json:"step,omitempty"`      // Width of a linear bucket
+	SlotField string  `json:"slotField,omitempty"` // Key field holding the slot, empty when the key is the slot
+	SumPath   string  `json:"sumPath,omitempty"`   // Pinned map holding the sum of observed values, keyed like the labels
+	Scale     float64 `json:"scale,omitempty"`     // Multiplier for bucket bounds and the sum, e.g. 1e-9 for ns to seconds
+}
+
+// IsHistogram reports whether the program's map holds histogram buckets
+func (p EBPFProgram) IsHistogram() bool {
+	return strings.EqualFold(p.Type, HistogramType)
+}
+
+// Aggregations of per-CPU map values
+const (
+	AggregateSum = "sum"
+	AggregateMax = "max"
+	AggregateMin = "min"
+	AggregateAvg = "avg"
+	AggregateCPU = "cpu"
+)
+
+// Metric maps a value field of the map to a Prometheus metric
+type Metric struct {
+	Name  string `json:"name"`
+	Help  string `json:"help,omitempty"`
+	Type  string `json:"type"`
+	Field string `json:"field,omitempty"` // Dotted value field path, empty for a scalar value
+}
+
+// MetricList returns the metrics fed by the program's map. Without explicit
+// metrics the whole value feeds a single metric named after the program.
+func (p EBPFProgram) MetricList() []Metric {
+	if len(p.Metrics) > 0 {
+		return p.Metrics
+	}
+	return []Metric{{Name: p.Name, Help: p.Help, Type: p.Type}}
+}
+
+// LabelNames returns the label names taken from the map key.
+// Key fields double as label names when no labels are given.
+func (p EBPFProgram) LabelNames() []string {
+	if len(p.Labels) > 0 || len(p.KeyFields) == 0 {
+		return p.Labels
+	}
+	names := make([]string, 0, len(p.KeyFields))
+	for _, field := range p.KeyFields {
+		names = append(names, strings.ReplaceAll(field, ".", "_"))
+	}
+	return names
+}
+
+// MetricLabelNames returns the label names registered with Prometheus,
+// including the cpu label when per-CPU values are not reduced
+func (p EBPFProgram) MetricLabelNames() []string {
+	names := append([]string(nil), p.LabelNames()...)
+	if p.Aggregation == AggregateCPU {
+		names = append(names, "cpu")
+	}
+	return names
+}
+
+// Validate checks that labels line up with key fields and metrics are complete
+func (p EBPFProgram) Validate() error {
+	if err := p.validateSchedule(); err != nil {
+		return err
+	}
+	switch p.Aggregation {
+	case "", AggregateSum, AggregateMax, AggregateMin, AggregateAvg, AggregateCPU:
+	default:
+		return fmt.Errorf("unsupported aggregation %q", p.Aggregation)
+	}
+	if len(p.KeyFields) > 0 && len(p.Labels) > 0 && len(p.KeyFields) != len(p.Labels) {
+		return fmt.Errorf("got %d labels for %d key fields", len(p.Labels), len(p.KeyFields))
+	}
+	if p.IsHistogram() {
+		return p.validateHistogram()
+	}
+	if p.Events != nil {
+		return p.validateEvents()
+	}
+	for _, m := range p.Metrics {
+		if m.Name == "" || m.Type == "" {
+			return fmt.Errorf("metric for field %q needs a name and a type", m.Field)
+		}
+	}
+	return nil
+}
+
+func (p EBPFProgram) validateSchedule() error {
+	if p.Interval != "" {
+		d, err := time.ParseDuration(p.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid interval: %w", err)
+		}
+		if d < MinInterval {
+			return fmt.Errorf("interval %s is shorter than %s", d, MinInterval)
+		}
+		if p.Events != nil {
+			return errors.New("event records are counted as they arrive and take no interval")
+		}
+	}
+	if p.Timeout != "" {
+		d, err := time.ParseDuration(p.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout: %w", err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("timeout %s must be positive", d)
+		}
+	}
+	return nil
+}
+
+func (p EBPFProgram) validateEvents() error {
+	if p.Aggregation != "" {
+		return errors.New("event records have no per-CPU values to aggregate")
+	}
+	if len(p.KeyFields) > 0 && p.Events.RecordType == "" {
+		return errors.New("labelling events by field needs a record type")
+	}
+	if len(p.Labels) > 0 && len(p.KeyFields) == 0 {
+		return errors.New("event labels need key fields")
+	}
+	for _, m := range p.MetricList() {
+		if !strings.EqualFold(m.Type, "Counter") {
+			return fmt.Errorf("event metric %s must be a Counter", m.Name)
+		}
+	}
+	return nil
+}
+
+func (p EBPFProgram) validateHistogram() error {
+	if len(p.Metrics) > 0 {
+		return errors.New("histograms take their buckets from the whole value, metrics cannot be set")
+	}
+	if p.Aggregation == AggregateCPU {
+		return errors.New("histograms cannot be split by cpu")
+	}
+	if len(p.Labels) > 0 && len(p.KeyFields) == 0 {
+		return errors.New("histogram labels need key fields")
+	}
+	h := p.Histogram
+	if h == nil {
+		return nil
+	}
+	switch h.Buckets {
+	case "", BucketsLog2:
+	case BucketsLinear:
+		if h.Step <= 0 {
+			return errors.New("linear histograms need a positive step")
+		}
+		if h.Step != math.Trunc(h.Step) || h.Min != math.Trunc(h.Min) {
+			return errors.New("linear histogram min and step must be whole numbers")
+		}
+	default:
+		return fmt.Errorf("unsupported bucket layout %q", h.Buckets)
+	}
+	for _, field := range p.KeyFields {
+		if field == h.SlotField {
+			return fmt.Errorf("slot field %q cannot be a label", field)
+		}
+	}
+	if h.Scale < 0 {
+		return errors.New("histogram scale must not be negative")
+	}
+	return nil
 }
 
 var (
@@ -17,18 +250,13 @@ var (
 	lock         = sync.RWMutex{}
 )
 
-func AddProgram(name string, path string, programType string) error {
+func AddProgram(program EBPFProgram) error {
 	lock.Lock()
 	defer lock.Unlock()
-	if _, exists := ebpfPrograms[name]; exists {
-		return errors.New("program already exists: " + name)
-	}
-	var program = EBPFProgram{
-		Name: name,
-		Path: path,
-		Type: programType,
+	if _, exists := ebpfPrograms[program.Name]; exists {
+		return errors.New("program already exists: " + program.Name)
 	}
-	ebpfPrograms[name] = program
+	ebpfPrograms[program.Name] = program
 	return nil
 }
 
@@ -0,0 +1,25 @@
+package ebpf
+
+import "testing"
+
+func TestValidateLinearHistogram(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    Histogram
+		wantErr bool
+	}{
+		{"whole min and step", Histogram{Buckets: BucketsLinear, Min: -10, Step: 5}, false},
+		{"missing step", Histogram{Buckets: BucketsLinear}, true},
+		{"fractional step", Histogram{Buckets: BucketsLinear, Step: 0.5}, true},
+		{"fractional min", Histogram{Buckets: BucketsLinear, Min: 1.5, Step: 2}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := tt.spec
+			prog := EBPFProgram{Name: "size", Type: HistogramType, Histogram: &spec}
+			if err := prog.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package ebpf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// StateFile persists the registered programs so they can be restored after a restart.
+// It stays out of the Loader's state directory, where every JSON file is taken for a program manifest.
+var StateFile = "/var/lib/ebpforge-adapter/state.json"
+
+// saveLock keeps concurrent saves from interleaving on the temporary file
+var saveLock sync.Mutex
+
+// SaveState writes every registered program to StateFile
+func SaveState() error {
+	saveLock.Lock()
+	defer saveLock.Unlock()
+	programs := ListPrograms()
+	sort.Slice(programs, func(i, j int) bool { return programs[i].Name < programs[j].Name })
+	if programs == nil {
+		programs = []EBPFProgram{}
+	}
+	data, err := json.MarshalIndent(programs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(StateFile), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	tmp := StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := os.Rename(tmp, StateFile); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	return nil
+}
+
+// LoadState reads the programs saved in StateFile without registering them
+func LoadState() ([]EBPFProgram, error) {
+	data, err := os.ReadFile(StateFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+	var programs []EBPFProgram
+	if err := json.Unmarshal(data, &programs); err != nil {
+		return nil, fmt.Errorf("failed to decode state %s: %w", StateFile, err)
+	}
+	return programs, nil
+}
@@ -0,0 +1,358 @@
+package events
+
+import (
+	"adapter/internal/bpfmap"
+	"adapter/internal/decode"
+	"adapter/internal/ebpf"
+	"adapter/prometheus"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cebpf "github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/perf"
+	"github.com/cilium/ebpf/ringbuf"
+)
+
+// perfBufferPages is the size of each per-CPU perf buffer in pages
+const perfBufferPages = 64
+
+// remapInterval is how often a consumer checks whether the Loader replaced its map
+const remapInterval = 5 * time.Second
+
+// subscriberBuffer is how many records a slow stream subscriber may fall behind before records are dropped
+const subscriberBuffer = 256
+
+type reader interface {
+	SetDeadline(time.Time)
+	Close() error
+}
+
+// Consumer reads the records of one program's ring buffer or perf event array
+// and keeps running totals of its counters
+type Consumer struct {
+	prog       ebpf.EBPFProgram
+	recordType btf.Type
+	mapID      uint32
+	reader     reader
+	done       chan struct{}
+
+	mu          sync.Mutex
+	closed      bool
+	totals      map[string]*prometheus.Sample
+	subscribers map[chan []byte]struct{}
+}
+
+var (
+	consumers = make(map[string]*Consumer)
+	lock      = sync.RWMutex{}
+)
+
+// Start begins consuming the records of prog
+func Start(prog ebpf.EBPFProgram) error {
+	lock.Lock()
+	defer lock.Unlock()
+	if _, exists := consumers[prog.Name]; exists {
+		return errors.New("consumer already exists: " + prog.Name)
+	}
+	c, err := newConsumer(prog)
+	if err != nil {
+		return err
+	}
+	consumers[prog.Name] = c
+	go c.run()
+	return nil
+}
+
+// Stop stops consuming the records of the named program
+func Stop(name string) {
+	lock.Lock()
+	c, ok := consumers[name]
+	delete(consumers, name)
+	lock.Unlock()
+	if ok {
+		c.close()
+	}
+}
+
+// Snapshot returns the current totals of the named program's counters
+func Snapshot(name string) (*prometheus.Snapshot, error) {
+	lock.RLock()
+	c, ok := consumers[name]
+	lock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no event consumer for %s", name)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snapshot := &prometheus.Snapshot{MapID: c.mapID}
+	for _, sample := range c.totals {
+		snapshot.Samples = append(snapshot.Samples, *sample)
+	}
+	return snapshot, nil
+}
+
+// Subscribe returns a channel of JSON encoded records of the named program
+// and a function to cancel the subscription. The channel is closed when the
+// consumer stops.
+func Subscribe(name string) (<-chan []byte, func(), error) {
+	lock.RLock()
+	c, ok := consumers[name]
+	lock.RUnlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("no event consumer for %s", name)
+	}
+	if !c.prog.Events.Stream {
+		return nil, nil, fmt.Errorf("streaming is not enabled for %s", name)
+	}
+	ch := make(chan []byte, subscriberBuffer)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.subscribers == nil {
+		// Already stopped
+		close(ch)
+		return ch, func() {}, nil
+	}
+	c.subscribers[ch] = struct{}{}
+	cancel := func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if _, ok := c.subscribers[ch]; ok {
+			delete(c.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel, nil
+}
+
+func newConsumer(prog ebpf.EBPFProgram) (*Consumer, error) {
+	c := &Consumer{
+		prog:        prog,
+		done:        make(chan struct{}),
+		totals:      make(map[string]*prometheus.Sample),
+		subscribers: make(map[chan []byte]struct{}),
+	}
+	var err error
+	if prog.Events.RecordType != "" {
+		c.recordType, err = bpfmap.EventType(prog.Path, prog.Events.RecordType)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.reader, c.mapID, err = openReader(prog.Path)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// openReader opens a reader on the pinned ring buffer or perf event array at
+// path and returns it with the ID of the map
+func openReader(path string) (reader, uint32, error) {
+	m, err := cebpf.LoadPinnedMap(path, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open pinned map %s: %w", path, err)
+	}
+	// The reader keeps its own reference to the map
+	defer m.Close()
+	var mapID uint32
+	if info, err := m.Info(); err == nil {
+		id, _ := info.ID()
+		mapID = uint32(id)
+	}
+	var r reader
+	switch m.Type() {
+	case cebpf.RingBuf:
+		r, err = ringbuf.NewReader(m)
+	case cebpf.PerfEventArray:
+		r, err = perf.NewReader(m, perfBufferPages*os.Getpagesize())
+	default:
+		return nil, 0, fmt.Errorf("map %s is a %v, not a ring buffer or perf event array", path, m.Type())
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create reader: %w", err)
+	}
+	return r, mapID, nil
+}
+
+// pinnedMapID returns the ID of the map pinned at path
+func pinnedMapID(path string) (uint32, error) {
+	m, err := cebpf.LoadPinnedMap(path, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open pinned map %s: %w", path, err)
+	}
+	defer m.Close()
+	info, err := m.Info()
+	if err != nil {
+		return 0, err
+	}
+	id, _ := info.ID()
+	return uint32(id), nil
+}
+
+// remap switches to the map pinned at the program's path when the Loader
+// replaced it, as it does when reloading or restoring the program. Like for
+// other recreated maps, every counter starts over.
+func (c *Consumer) remap() error {
+	id, err := pinnedMapID(c.prog.Path)
+	if err != nil || id == c.mapID {
+		return err
+	}
+	recordType := c.recordType
+	if c.prog.Events.RecordType != "" {
+		if recordType, err = bpfmap.EventType(c.prog.Path, c.prog.Events.RecordType); err != nil {
+			return err
+		}
+	}
+	r, id, err := openReader(c.prog.Path)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return r.Close()
+	}
+	old := c.reader
+	c.reader = r
+	c.recordType = recordType
+	c.mapID = id
+	c.totals = make(map[string]*prometheus.Sample)
+	c.mu.Unlock()
+	fmt.Printf("Map of %s was replaced, reading events from map %d\n", c.prog.Name, id)
+	return old.Close()
+}
+
+func (c *Consumer) run() {
+	defer close(c.done)
+	checked := time.Now()
+	for {
+		if time.Since(checked) >= remapInterval {
+			checked = time.Now()
+			if err := c.remap(); err != nil {
+				fmt.Printf("Failed to check map of %s: %v\n", c.prog.Name, err)
+			}
+		}
+		c.reader.SetDeadline(checked.Add(remapInterval))
+		raw, lost, err := c.read()
+		if errors.Is(err, os.ErrClosed) {
+			return
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Failed to read event of %s: %v\n", c.prog.Name, err)
+			continue
+		}
+		if lost > 0 {
+			fmt.Printf("Lost %d events of %s\n", lost, c.prog.Name)
+			continue
+		}
+		if err := c.handle(raw); err != nil {
+			fmt.Printf("Failed to handle event of %s: %v\n", c.prog.Name, err)
+		}
+	}
+}
+
+// read returns the next record, or the number of records the kernel dropped
+func (c *Consumer) read() ([]byte, uint64, error) {
+	switch r := c.reader.(type) {
+	case *ringbuf.Reader:
+		record, err := r.Read()
+		return record.RawSample, 0, err
+	case *perf.Reader:
+		record, err := r.Read()
+		return record.RawSample, record.LostSamples, err
+	default:
+		return nil, 0, fmt.Errorf("unknown reader %T", c.reader)
+	}
+}
+
+// handle decodes a record, adds it to the counters and forwards it to stream subscribers
+func (c *Consumer) handle(raw []byte) error {
+	record, err := decode.Decode(c.recordType, raw)
+	if err != nil {
+		return err
+	}
+	var labels []string
+	if len(c.prog.KeyFields) > 0 {
+		if labels, err = record.Labels(c.prog.KeyFields); err != nil {
+			return err
+		}
+	}
+	metrics := c.prog.MetricList()
+	increments := make([]float64, len(metrics))
+	for i, metric := range metrics {
+		increments[i] = 1
+		if metric.Field != "" {
+			if increments[i], err = record.Number(metric.Field); err != nil {
+				return fmt.Errorf("metric %s: %w", metric.Name, err)
+			}
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, metric := range metrics {
+		key := metric.Name + "\xff" + strings.Join(labels, "\xff")
+		total, ok := c.totals[key]
+		if !ok {
+			total = &prometheus.Sample{Metric: metric.Name, Labels: labels}
+			c.totals[key] = total
+		}
+		total.Value += increments[i]
+	}
+	if len(c.subscribers) > 0 {
+		data, err := json.Marshal(recordJSON(record))
+		if err != nil {
+			return err
+		}
+		for ch := range c.subscribers {
+			select {
+			case ch <- data:
+			default:
+				// Never block the consumer on a slow subscriber
+			}
+		}
+	}
+	return nil
+}
+
+// recordJSON turns decoded fields into a JSON object, keeping numbers exact
+func recordJSON(record decode.Fields) map[string]interface{} {
+	obj := make(map[string]interface{}, len(record))
+	for name, v := range record {
+		if name == "" {
+			name = "value"
+		}
+		if _, err := strconv.ParseFloat(v.Text, 64); v.Numeric && err == nil {
+			obj[name] = json.Number(v.Text)
+		} else {
+			obj[name] = v.Text
+		}
+	}
+	return obj
+}
+
+func (c *Consumer) close() {
+	c.mu.Lock()
+	c.closed = true
+	r := c.reader
+	c.mu.Unlock()
+	if err := r.Close(); err != nil {
+		fmt.Printf("Failed to close event reader of %s: %v\n", c.prog.Name, err)
+	}
+	<-c.done
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ch := range c.subscribers {
+		close(ch)
+	}
+	c.subscribers = nil
+}
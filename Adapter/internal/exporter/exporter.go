@@ -0,0 +1,275 @@
+package exporter
+
+import (
+	"adapter/internal/bpfmap"
+	"adapter/internal/decode"
+	"adapter/internal/ebpf"
+	"adapter/internal/events"
+	"adapter/prometheus"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Read reads the map of prog and turns its entries into samples of the
+// program's metrics
+func Read(prog ebpf.EBPFProgram) (*prometheus.Snapshot, error) {
+	dump, err := bpfmap.ReadPinnedMap(prog.Path)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &prometheus.Snapshot{MapID: uint32(dump.MapID)}
+	if prog.IsHistogram() {
+		var sums map[string]float64
+		if prog.Histogram != nil && prog.Histogram.SumPath != "" {
+			if sums, err = readSums(prog, prog.Histogram.SumPath); err != nil {
+				return nil, err
+			}
+		}
+		snapshot.Histograms, err = histograms(prog, dump, sums)
+		if err != nil {
+			return nil, err
+		}
+		return snapshot, nil
+	}
+	for _, entry := range dump.Entries {
+		samples, err := entrySamples(prog, dump, entry)
+		if err != nil {
+			fmt.Printf("Failed to export entry of %s: %v\n", prog.Name, err)
+			continue
+		}
+		snapshot.Samples = append(snapshot.Samples, samples...)
+	}
+	return snapshot, nil
+}
+
+// Source returns a prometheus.Source for prog. Maps with a read interval are
+// served from the last background read, ring buffers and perf event arrays
+// from the totals of their event consumer and any other map is read on scrape.
+func Source(prog ebpf.EBPFProgram) prometheus.Source {
+	if prog.Events != nil {
+		return func() (*prometheus.Snapshot, error) {
+			return events.Snapshot(prog.Name)
+		}
+	}
+	if prog.ReadInterval() > 0 {
+		return func() (*prometheus.Snapshot, error) {
+			return Cached(prog.Name)
+		}
+	}
+	g := &guard{}
+	return func() (*prometheus.Snapshot, error) {
+		return g.read(prog)
+	}
+}
+
+// entrySamples decodes one map entry into a sample for every metric fed by it
+func entrySamples(prog ebpf.EBPFProgram, dump *bpfmap.Dump, entry bpfmap.Entry) ([]prometheus.Sample, error) {
+	key, err := decode.Decode(dump.KeyType, entry.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode key: %w", err)
+	}
+	values := make([]decode.Fields, 0, len(entry.Values))
+	for _, raw := range entry.Values {
+		value, err := decode.Decode(dump.ValueType, raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode value: %w", err)
+		}
+		values = append(values, value)
+	}
+	labels, err := key.Labels(prog.KeyFields)
+	if err != nil {
+		return nil, err
+	}
+	perCPU := prog.Aggregation == ebpf.AggregateCPU
+	if perCPU && !dump.PerCPU {
+		return nil, fmt.Errorf("cpu aggregation needs a per-CPU map")
+	}
+	var samples []prometheus.Sample
+	for _, metric := range prog.MetricList() {
+		numbers := make([]float64, 0, len(values))
+		for _, value := range values {
+			v, err := value.Number(metric.Field)
+			if err != nil {
+				return nil, fmt.Errorf("metric %s: %w", metric.Name, err)
+			}
+			numbers = append(numbers, v)
+		}
+		if !perCPU {
+			samples = append(samples, prometheus.Sample{
+				Metric: metric.Name,
+				Labels: labels,
+				Value:  reduce(prog.Aggregation, numbers),
+			})
+			continue
+		}
+		for cpu, v := range numbers {
+			samples = append(samples, prometheus.Sample{
+				Metric: metric.Name,
+				Labels: append(append([]string(nil), labels...), strconv.Itoa(cpu)),
+				Value:  v,
+			})
+		}
+	}
+	return samples, nil
+}
+
+// reduce folds the per-CPU values of a key into one value
+func reduce(aggregation string, values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	result := values[0]
+	for _, v := range values[1:] {
+		switch aggregation {
+		case ebpf.AggregateMax:
+			result = math.Max(result, v)
+		case ebpf.AggregateMin:
+			result = math.Min(result, v)
+		default:
+			result += v
+		}
+	}
+	if aggregation == ebpf.AggregateAvg {
+		result /= float64(len(values))
+	}
+	return result
+}
+
+// histogramSeries collects the slot counts of one label set
+type histogramSeries struct {
+	labels []string
+	slots  map[int]uint64
+}
+
+// histograms folds the slot counters of a histogram map into one histogram
+// per label set. Per-CPU slot counters are always summed. sums holds the
+// contents of the sum map keyed by label set, nil when there is none.
+func histograms(prog ebpf.EBPFProgram, dump *bpfmap.Dump, sums map[string]float64) ([]prometheus.HistogramSample, error) {
+	spec := ebpf.Histogram{}
+	if prog.Histogram != nil {
+		spec = *prog.Histogram
+	}
+	scale := spec.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	series := make(map[string]*histogramSeries)
+	var order []string
+	for _, entry := range dump.Entries {
+		key, err := decode.Decode(dump.KeyType, entry.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode key: %w", err)
+		}
+		slot, err := key.Number(spec.SlotField)
+		if err != nil {
+			return nil, fmt.Errorf("slot: %w", err)
+		}
+		labels, err := histogramLabels(prog, key)
+		if err != nil {
+			return nil, err
+		}
+		count, err := sumValues(dump, entry)
+		if err != nil {
+			return nil, err
+		}
+		group := strings.Join(labels, "\xff")
+		s, ok := series[group]
+		if !ok {
+			s = &histogramSeries{labels: labels, slots: make(map[int]uint64)}
+			series[group] = s
+			order = append(order, group)
+		}
+		s.slots[int(slot)] += uint64(count)
+	}
+
+	samples := make([]prometheus.HistogramSample, 0, len(order))
+	for _, group := range order {
+		s := series[group]
+		maxSlot := 0
+		for slot := range s.slots {
+			maxSlot = max(maxSlot, slot)
+		}
+		sample := prometheus.HistogramSample{
+			Metric:  prog.Name,
+			Labels:  s.labels,
+			Buckets: make(map[float64]uint64, maxSlot+1),
+		}
+		for slot := 0; slot <= maxSlot; slot++ {
+			_, high := slotBounds(spec, slot)
+			sample.Count += s.slots[slot]
+			sample.Buckets[high*scale] = sample.Count
+		}
+		// Without a sum map the sum stays 0 rather than a guess from the buckets
+		if sums != nil {
+			sample.Sum = sums[group] * scale
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+// slotBounds returns the smallest and largest integer counted by a slot
+func slotBounds(spec ebpf.Histogram, slot int) (float64, float64) {
+	if spec.Buckets == ebpf.BucketsLinear {
+		low := spec.Min + float64(slot)*spec.Step
+		// Observed values are integers and Validate keeps Min and Step whole,
+		// so the slot ends right before the next one starts
+		return low, low + spec.Step - 1
+	}
+	if slot == 0 {
+		return 0, 0
+	}
+	return math.Ldexp(1, slot-1), math.Ldexp(1, slot) - 1
+}
+
+// histogramLabels returns the label values of a histogram key
+func histogramLabels(prog ebpf.EBPFProgram, key decode.Fields) ([]string, error) {
+	if len(prog.KeyFields) == 0 {
+		return nil, nil
+	}
+	return key.Labels(prog.KeyFields)
+}
+
+// sumValues sums the scalar value of an entry over all CPUs
+func sumValues(dump *bpfmap.Dump, entry bpfmap.Entry) (float64, error) {
+	var total float64
+	for _, raw := range entry.Values {
+		value, err := decode.Decode(dump.ValueType, raw)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decode value: %w", err)
+		}
+		v, err := value.Number("")
+		if err != nil {
+			return 0, err
+		}
+		total += v
+	}
+	return total, nil
+}
+
+// readSums reads the sum map of a histogram, keyed like the histogram's labels
+func readSums(prog ebpf.EBPFProgram, path string) (map[string]float64, error) {
+	dump, err := bpfmap.ReadPinnedMap(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sum map: %w", err)
+	}
+	sums := make(map[string]float64, len(dump.Entries))
+	for _, entry := range dump.Entries {
+		key, err := decode.Decode(dump.KeyType, entry.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode sum key: %w", err)
+		}
+		labels, err := histogramLabels(prog, key)
+		if err != nil {
+			return nil, fmt.Errorf("sum map: %w", err)
+		}
+		v, err := sumValues(dump, entry)
+		if err != nil {
+			return nil, fmt.Errorf("sum map: %w", err)
+		}
+		sums[strings.Join(labels, "\xff")] += v
+	}
+	return sums, nil
+}
@@ -0,0 +1,156 @@
+package exporter
+
+import (
+	"adapter/internal/bpfmap"
+	"adapter/internal/ebpf"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/cilium/ebpf/btf"
+)
+
+func u32(v uint32) []byte {
+	return binary.NativeEndian.AppendUint32(nil, v)
+}
+
+func u64(v uint64) []byte {
+	return binary.NativeEndian.AppendUint64(nil, v)
+}
+
+// slotDump returns a histogram map keyed by slot with one counter per CPU
+func slotDump(counts map[uint32][]uint64) *bpfmap.Dump {
+	dump := &bpfmap.Dump{}
+	for slot, perCPU := range counts {
+		entry := bpfmap.Entry{Key: u32(slot)}
+		for _, c := range perCPU {
+			entry.Values = append(entry.Values, u64(c))
+		}
+		dump.Entries = append(dump.Entries, entry)
+	}
+	return dump
+}
+
+func TestSlotBounds(t *testing.T) {
+	linear := ebpf.Histogram{Buckets: ebpf.BucketsLinear, Min: 10, Step: 5}
+	tests := []struct {
+		name      string
+		spec      ebpf.Histogram
+		slot      int
+		low, high float64
+	}{
+		{"log2 slot 0", ebpf.Histogram{}, 0, 0, 0},
+		{"log2 slot 1", ebpf.Histogram{}, 1, 1, 1},
+		{"log2 slot 2", ebpf.Histogram{Buckets: ebpf.BucketsLog2}, 2, 2, 3},
+		{"log2 slot 10", ebpf.Histogram{}, 10, 512, 1023},
+		{"linear first slot", linear, 0, 10, 14},
+		{"linear slot 3", linear, 3, 25, 29},
+		{"linear from zero", ebpf.Histogram{Buckets: ebpf.BucketsLinear, Step: 100}, 2, 200, 299},
+		{"linear below zero", ebpf.Histogram{Buckets: ebpf.BucketsLinear, Min: -10, Step: 4}, 1, -6, -3},
+		{"linear step of one", ebpf.Histogram{Buckets: ebpf.BucketsLinear, Step: 1}, 7, 7, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			low, high := slotBounds(tt.spec, tt.slot)
+			if low != tt.low || high != tt.high {
+				t.Errorf("slotBounds(%d) = [%v, %v], want [%v, %v]", tt.slot, low, high, tt.low, tt.high)
+			}
+		})
+	}
+}
+
+func TestHistogramsLog2(t *testing.T) {
+	prog := ebpf.EBPFProgram{Name: "latency", Type: ebpf.HistogramType}
+	// Slot 2 is missing from the map, per-CPU counters are summed
+	dump := slotDump(map[uint32][]uint64{0: {1}, 1: {1, 1}, 3: {3, 1}})
+	samples, err := histograms(prog, dump, nil)
+	if err != nil {
+		t.Fatalf("histograms: %v", err)
+	}
+	if len(samples) != 1 {
+		t.Fatalf("got %d histograms, want 1", len(samples))
+	}
+	h := samples[0]
+	wantBuckets := map[float64]uint64{0: 1, 1: 3, 3: 3, 7: 7}
+	if !reflect.DeepEqual(h.Buckets, wantBuckets) {
+		t.Errorf("buckets = %v, want cumulative %v", h.Buckets, wantBuckets)
+	}
+	if h.Count != 7 {
+		t.Errorf("count = %d, want 7", h.Count)
+	}
+	// Without a sum map the sum is not guessed from the buckets
+	if h.Sum != 0 {
+		t.Errorf("sum without a sum map = %v, want 0", h.Sum)
+	}
+	if h.Metric != "latency" || h.Labels != nil {
+		t.Errorf("metric %q with labels %v", h.Metric, h.Labels)
+	}
+}
+
+func TestHistogramsLinear(t *testing.T) {
+	prog := ebpf.EBPFProgram{Name: "size", Type: ebpf.HistogramType, Histogram: &ebpf.Histogram{
+		Buckets: ebpf.BucketsLinear, Min: 100, Step: 50,
+	}}
+	samples, err := histograms(prog, slotDump(map[uint32][]uint64{0: {2}, 2: {5}}), nil)
+	if err != nil {
+		t.Fatalf("histograms: %v", err)
+	}
+	h := samples[0]
+	wantBuckets := map[float64]uint64{149: 2, 199: 2, 249: 7}
+	if !reflect.DeepEqual(h.Buckets, wantBuckets) {
+		t.Errorf("buckets = %v, want %v", h.Buckets, wantBuckets)
+	}
+	if h.Count != 7 || h.Sum != 0 {
+		t.Errorf("count = %d, sum = %v, want 7 and 0 without a sum map", h.Count, h.Sum)
+	}
+}
+
+func TestHistogramsSumMapAndScale(t *testing.T) {
+	key := &btf.Struct{Name: "hist_key", Size: 8, Members: []btf.Member{
+		{Name: "pid", Type: &btf.Int{Name: "u32", Size: 4}, Offset: 0},
+		{Name: "slot", Type: &btf.Int{Name: "u32", Size: 4}, Offset: 32},
+	}}
+	prog := ebpf.EBPFProgram{
+		Name:      "runq_latency_seconds",
+		Type:      ebpf.HistogramType,
+		KeyFields: []string{"pid"},
+		Histogram: &ebpf.Histogram{SlotField: "slot", SumPath: "/sys/fs/bpf/runq/sums", Scale: 1e-9},
+	}
+	entry := func(pid, slot uint32, count uint64) bpfmap.Entry {
+		return bpfmap.Entry{Key: append(u32(pid), u32(slot)...), Values: [][]byte{u64(count)}}
+	}
+	dump := &bpfmap.Dump{KeyType: key, Entries: []bpfmap.Entry{
+		entry(1, 1, 2),
+		entry(2, 2, 1),
+		entry(1, 2, 3),
+	}}
+	sums := map[string]float64{"1": 9000, "2": 2500}
+	samples, err := histograms(prog, dump, sums)
+	if err != nil {
+		t.Fatalf("histograms: %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("got %d histograms, want one per pid", len(samples))
+	}
+	byPID := make(map[string]int)
+	for i, h := range samples {
+		byPID[h.Labels[0]] = i
+	}
+	first := samples[byPID["1"]]
+	if first.Count != 5 {
+		t.Errorf("count of pid 1 = %d, want 5", first.Count)
+	}
+	// Bucket bounds are scaled as well, slot 0 is empty
+	scale := prog.Histogram.Scale
+	if len(first.Buckets) != 3 || first.Buckets[0] != 0 || first.Buckets[1*scale] != 2 || first.Buckets[3*scale] != 5 {
+		t.Errorf("buckets of pid 1 = %v", first.Buckets)
+	}
+	// The sum map replaces the midpoint estimate
+	if math.Abs(first.Sum-9e-6) > 1e-18 {
+		t.Errorf("sum of pid 1 = %v, want 9e-6 from the sum map", first.Sum)
+	}
+	if second := samples[byPID["2"]]; math.Abs(second.Sum-2.5e-6) > 1e-18 || second.Count != 1 {
+		t.Errorf("pid 2: count %d, sum %v", second.Count, second.Sum)
+	}
+}
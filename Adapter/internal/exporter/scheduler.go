@@ -0,0 +1,165 @@
+package exporter
+
+import (
+	"adapter/internal/ebpf"
+	"adapter/prometheus"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Workers is the number of maps read concurrently in the background
+var Workers = 4
+
+// jitter is the fraction by which each background read interval is randomly
+// stretched or shortened so programs registered together do not read in lockstep
+const jitter = 0.1
+
+var (
+	pollers   = make(map[string]*poller)
+	lock      = sync.Mutex{}
+	jobs      = make(chan *poller)
+	startPool sync.Once
+)
+
+// guard keeps reads of one map from piling up behind a read that timed out
+type guard struct {
+	mu   sync.Mutex
+	busy bool
+}
+
+type readResult struct {
+	snapshot *prometheus.Snapshot
+	err      error
+}
+
+// read reads the map of prog, giving up after the program's timeout. Map
+// reads cannot be interrupted, so a timed out read keeps the guard busy
+// until it returns.
+func (g *guard) read(prog ebpf.EBPFProgram) (*prometheus.Snapshot, error) {
+	g.mu.Lock()
+	if g.busy {
+		g.mu.Unlock()
+		return nil, errors.New("previous read is still running")
+	}
+	g.busy = true
+	g.mu.Unlock()
+
+	done := make(chan readResult, 1)
+	go func() {
+		snapshot, err := Read(prog)
+		g.mu.Lock()
+		g.busy = false
+		g.mu.Unlock()
+		done <- readResult{snapshot, err}
+	}()
+	timeout := prog.ReadTimeout()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.snapshot, r.err
+	case <-timer.C:
+		return nil, fmt.Errorf("read timed out after %s", timeout)
+	}
+}
+
+// poller reads a program's map every interval and keeps the last result
+type poller struct {
+	prog  ebpf.EBPFProgram
+	guard guard
+	stop  chan struct{}
+	done  chan struct{}
+
+	mu     sync.Mutex
+	result *readResult
+}
+
+// Start reads the map of prog in the background every ReadInterval
+func Start(prog ebpf.EBPFProgram) error {
+	if prog.ReadInterval() <= 0 {
+		return fmt.Errorf("%s has no read interval", prog.Name)
+	}
+	startPool.Do(func() {
+		for i := 0; i < max(Workers, 1); i++ {
+			go worker()
+		}
+	})
+	lock.Lock()
+	defer lock.Unlock()
+	if _, exists := pollers[prog.Name]; exists {
+		return errors.New("poller already exists: " + prog.Name)
+	}
+	p := &poller{
+		prog: prog,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	pollers[prog.Name] = p
+	go p.run()
+	return nil
+}
+
+// Stop stops reading the map of the named program in the background
+func Stop(name string) {
+	lock.Lock()
+	p, ok := pollers[name]
+	delete(pollers, name)
+	lock.Unlock()
+	if ok {
+		close(p.stop)
+		<-p.done
+	}
+}
+
+// Cached returns the result of the last background read of the named program
+func Cached(name string) (*prometheus.Snapshot, error) {
+	lock.Lock()
+	p, ok := pollers[name]
+	lock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no poller for %s", name)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.result == nil {
+		return nil, errors.New("no read has completed yet")
+	}
+	return p.result.snapshot, p.result.err
+}
+
+// run hands the poller to the worker pool right away and then every jittered interval
+func (p *poller) run() {
+	defer close(p.done)
+	var delay time.Duration
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case <-p.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		select {
+		case jobs <- p:
+		case <-p.stop:
+			return
+		}
+		delay = jittered(p.prog.ReadInterval())
+	}
+}
+
+func worker() {
+	for p := range jobs {
+		snapshot, err := p.guard.read(p.prog)
+		p.mu.Lock()
+		p.result = &readResult{snapshot, err}
+		p.mu.Unlock()
+	}
+}
+
+func jittered(d time.Duration) time.Duration {
+	return d + time.Duration((rand.Float64()*2-1)*jitter*float64(d))
+}
@@ -2,35 +2,94 @@ package main
 
 import (
 	"adapter/api"
+	"adapter/internal/ebpf"
+	"adapter/internal/exporter"
 	"adapter/prometheus"
-	"adapter/timer"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 )
 
 func main() {
 	var nodeFlag = flag.String("node", "unknown-node", "Node label to attach to all Prometheus metrics")
+	var stateFlag = flag.String("state", ebpf.StateFile, "File persisting registered programs across restarts")
+	var workersFlag = flag.Int("workers", exporter.Workers, "Number of maps read concurrently in the background")
+	var apiAddrFlag = flag.String("api-addr", ":8080", "Listen address of the registration API and health probes")
+	var metricsAddrFlag = flag.String("metrics-addr", prometheus.DefaultMetricsAddr, "Listen address of the Prometheus metrics endpoint")
+	var readTimeoutFlag = flag.Duration("read-timeout", 10*time.Second, "Maximum duration for reading a request")
+	var writeTimeoutFlag = flag.Duration("write-timeout", 30*time.Second, "Maximum duration for writing a response, event streams are exempt")
+	var shutdownTimeoutFlag = flag.Duration("shutdown-timeout", 15*time.Second, "Time allowed for in-flight requests on shutdown")
 	flag.Parse()
 	prometheus.Node = *nodeFlag
-	flag.Parse()
-	tickerInterval := 10 * time.Second
-	timer.StartScheduler(tickerInterval)
-	go prometheus.StartPrometheusServer("8080")
-	go func() {
-		fmt.Println("API Server starting on :8080...")
-		api.StartServer()
-	}()
-	waitForShutdown()
+	ebpf.StateFile = *stateFlag
+	exporter.Workers = *workersFlag
+	api.Restore()
+
+	// Cancelled on shutdown so long-lived event streams end
+	baseCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	newServer := func(addr string, handler http.Handler) *http.Server {
+		return &http.Server{
+			Addr:              addr,
+			Handler:           handler,
+			ReadHeaderTimeout: *readTimeoutFlag,
+			ReadTimeout:       *readTimeoutFlag,
+			WriteTimeout:      *writeTimeoutFlag,
+			IdleTimeout:       2 * time.Minute,
+			BaseContext:       func(net.Listener) context.Context { return baseCtx },
+		}
+	}
+	servers := map[string]*http.Server{
+		"API":     newServer(*apiAddrFlag, api.NewHandler()),
+		"metrics": newServer(*metricsAddrFlag, prometheus.Handler()),
+	}
+	failed := make(chan error, len(servers))
+	for name, server := range servers {
+		go func(name string, server *http.Server) {
+			fmt.Printf("Starting %s server on %s\n", name, server.Addr)
+			if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				failed <- fmt.Errorf("%s server: %w", name, err)
+			}
+		}(name, server)
+	}
+	api.SetReady(true)
+	waitForShutdown(failed)
+
+	api.SetReady(false)
+	cancel()
+	ctx, stop := context.WithTimeout(context.Background(), *shutdownTimeoutFlag)
+	defer stop()
+	var wg sync.WaitGroup
+	for name, server := range servers {
+		wg.Add(1)
+		go func(name string, server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				fmt.Printf("Failed to shut down %s server: %v\n", name, err)
+			}
+		}(name, server)
+	}
+	wg.Wait()
+	fmt.Println("Shutdown complete")
 }
 
-func waitForShutdown() {
+// waitForShutdown blocks until a termination signal arrives or a server fails
+func waitForShutdown(failed <-chan error) {
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-	s := <-sig
-	fmt.Printf("Received signal: %s\n", s)
+	select {
+	case s := <-sig:
+		fmt.Printf("Received signal: %s\n", s)
+	case err := <-failed:
+		fmt.Printf("Failed to serve: %v\n", err)
+	}
 	fmt.Println("Shutting down gracefully...")
 }
@@ -5,131 +5,277 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
 )
 
 var (
-	dynamicGauges   = make(map[string]*prometheus.GaugeVec)
-	dynamicCounters = make(map[string]*prometheus.CounterVec)
-	lock            = sync.RWMutex{}
+	collectors = make(map[string]*programCollector)
+	lock       = sync.RWMutex{}
 )
 
-func RegisterGauge(name string, help string, labels []string) error {
-	lock.Lock()
-	defer lock.Unlock()
-	if _, exists := dynamicGauges[name]; exists {
-		return nil
+// MetricSpec describes one metric exported from a program's map
+type MetricSpec struct {
+	Name string
+	Help string
+	Type string
+}
+
+// Sample is the current value of one series
+type Sample struct {
+	Metric string
+	Labels []string
+	Value  float64
+}
+
+// HistogramSample is the current state of one histogram series.
+// Buckets maps upper bounds to cumulative counts.
+type HistogramSample struct {
+	Metric  string
+	Labels  []string
+	Buckets map[float64]uint64
+	Count   uint64
+	Sum     float64
+}
+
+// Snapshot is the content of a program's map at one point in time
+type Snapshot struct {
+	MapID      uint32 // Identifies the kernel map the samples were read from
+	Samples    []Sample
+	Histograms []HistogramSample
+}
+
+// Source reads the current snapshot of a program's map
+type Source func() (*Snapshot, error)
+
+type metricDesc struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	histogram bool
+}
+
+// counterState remembers the last value of a cumulative series to detect resets
+type counterState struct {
+	value   float64
+	created time.Time
+}
+
+// programCollector exports the metrics of one program. The map is read at
+// scrape time and every series is emitted with the kernel's current value.
+type programCollector struct {
+	name   string
+	descs  map[string]metricDesc
+	source Source
+
+	mu       sync.Mutex
+	mapID    uint32
+	counters map[string]counterState
+}
+
+// programsCollector exports every registered program. It is registered once
+// as an unchecked collector because the Prometheus registry never forgets the
+// label names and help of an unregistered metric, which would prevent
+// re-registering a program with a changed definition.
+type programsCollector struct{}
+
+func init() {
+	prometheus.MustRegister(programsCollector{})
+}
+
+// Describe sends no descriptors, which makes the collector unchecked
+func (programsCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (programsCollector) Collect(ch chan<- prometheus.Metric) {
+	lock.RLock()
+	list := make([]*programCollector, 0, len(collectors))
+	for _, c := range collectors {
+		list = append(list, c)
 	}
-	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: name,
-		Help: help,
-	}, labels)
-	if err := prometheus.Register(gauge); err != nil {
-		return err
+	lock.RUnlock()
+	// Programs read on scrape are read concurrently
+	var wg sync.WaitGroup
+	for _, c := range list {
+		wg.Add(1)
+		go func(c *programCollector) {
+			defer wg.Done()
+			c.Collect(ch)
+		}(c)
 	}
-	dynamicGauges[name] = gauge
-	return nil
+	wg.Wait()
 }
 
-func RegisterCounter(name string, help string, labels []string) error {
-	lock.Lock()
-	defer lock.Unlock()
-	if _, exists := dynamicCounters[name]; exists {
-		return nil
+func (c *programCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range c.descs {
+		ch <- d.desc
 	}
-	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: name,
-		Help: help,
-	}, labels)
-	if err := prometheus.Register(counter); err != nil {
-		fmt.Printf("Failed to register counter %s: %v\n", name, err)
-		return err
+}
+
+func (c *programCollector) Collect(ch chan<- prometheus.Metric) {
+	snapshot, err := c.source()
+	if err != nil {
+		// Failing the whole scrape would hide every other program's metrics
+		fmt.Printf("Failed to read map for %s: %v\n", c.name, err)
+		return
 	}
-	dynamicCounters[name] = counter
-	for counterName := range dynamicCounters {
-		fmt.Printf("- %s\n", counterName)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if snapshot.MapID != c.mapID {
+		// The map was recreated, e.g. by a program reload, so every counter starts over
+		c.mapID = snapshot.MapID
+		c.counters = make(map[string]counterState)
+	}
+	seen := make(map[string]bool)
+	for _, sample := range mergeSamples(snapshot.Samples) {
+		d, ok := c.descs[sample.Metric]
+		if !ok || d.histogram {
+			continue
+		}
+		var metric prometheus.Metric
+		if d.valueType == prometheus.CounterValue {
+			key := seriesKey(sample)
+			created := c.observe(key, sample.Value, now)
+			seen[key] = true
+			metric, err = prometheus.NewConstMetricWithCreatedTimestamp(d.desc, d.valueType, sample.Value, created, sample.Labels...)
+		} else {
+			metric, err = prometheus.NewConstMetric(d.desc, d.valueType, sample.Value, sample.Labels...)
+		}
+		if err != nil {
+			fmt.Printf("Dropping sample of %s: %v\n", sample.Metric, err)
+			continue
+		}
+		ch <- metric
+	}
+	for _, sample := range snapshot.Histograms {
+		d, ok := c.descs[sample.Metric]
+		if !ok || !d.histogram {
+			continue
+		}
+		key := seriesKey(Sample{Metric: sample.Metric, Labels: sample.Labels})
+		created := c.observe(key, float64(sample.Count), now)
+		seen[key] = true
+		metric, err := prometheus.NewConstHistogramWithCreatedTimestamp(d.desc, sample.Count, sample.Sum, sample.Buckets, created, sample.Labels...)
+		if err != nil {
+			fmt.Printf("Dropping sample of %s: %v\n", sample.Metric, err)
+			continue
+		}
+		ch <- metric
+	}
+	// Forget series whose map entry is gone
+	for key := range c.counters {
+		if !seen[key] {
+			delete(c.counters, key)
+		}
 	}
-	return nil
 }
 
-// SetGauge sets the value of a GaugeVec
-func SetGauge(name string, value uint64, labelValues ...string) {
-	lock.RLock()
-	defer lock.RUnlock()
-	if gauge, exists := dynamicGauges[name]; exists {
-		fmt.Printf("Found gauge %s, setting value\n", name)
-		gauge.WithLabelValues(labelValues...).Set(float64(value))
-		fmt.Printf("Successfully set gauge %s value to %d with label values %v\n", name, value, labelValues)
-	} else {
-		fmt.Printf("Warning: Gauge %s does not exist, cannot set value\n", name)
-		// Optional: Print all available gauges
-		if len(dynamicGauges) > 0 {
-			fmt.Println("Currently available gauges:")
-			for gaugeName := range dynamicGauges {
-				fmt.Printf("- %s\n", gaugeName)
-			}
-		} else {
-			fmt.Println("No gauges currently registered")
+// observe records the current value of a cumulative series and returns the
+// time it was created. A value going backwards was reset in the kernel.
+func (c *programCollector) observe(key string, value float64, now time.Time) time.Time {
+	state, known := c.counters[key]
+	if !known || value < state.value {
+		state.created = now
+	}
+	state.value = value
+	c.counters[key] = state
+	return state.created
+}
+
+// mergeSamples sums samples that end up in the same series, which happens
+// when the key fields used as labels do not identify a map entry uniquely
+func mergeSamples(samples []Sample) []Sample {
+	index := make(map[string]int, len(samples))
+	merged := make([]Sample, 0, len(samples))
+	for _, sample := range samples {
+		key := seriesKey(sample)
+		if i, ok := index[key]; ok {
+			merged[i].Value += sample.Value
+			continue
 		}
+		index[key] = len(merged)
+		merged = append(merged, sample)
 	}
+	return merged
 }
 
-// AddCounter increments the value of a CounterVec
-func AddCounter(name string, value uint64, labelValues ...string) {
-	lock.RLock()
-	defer lock.RUnlock()
-	newLabelValues := append(labelValues, Node)
-	if counter, exists := dynamicCounters[name]; exists {
-		counter.WithLabelValues(newLabelValues...).Add(float64(value))
-	} else {
-		if len(dynamicCounters) > 0 {
-			for counterName := range dynamicCounters {
-				fmt.Printf("- %s\n", counterName)
+func seriesKey(sample Sample) string {
+	return sample.Metric + "\xff" + strings.Join(sample.Labels, "\xff")
+}
+
+// RegisterProgram registers the metrics of a program with Prometheus,
+// replacing any earlier registration under the same name so help, labels
+// and types can change. source is called on every scrape to read the program's map.
+func RegisterProgram(name string, metrics []MetricSpec, labels []string, source Source) error {
+	c := &programCollector{
+		name:     name,
+		descs:    make(map[string]metricDesc, len(metrics)),
+		source:   source,
+		counters: make(map[string]counterState),
+	}
+	for _, m := range metrics {
+		d := metricDesc{
+			desc: prometheus.NewDesc(m.Name, m.Help, labels, prometheus.Labels{"node": Node}),
+		}
+		switch {
+		case strings.EqualFold(m.Type, string(GaugeType)):
+			d.valueType = prometheus.GaugeValue
+		case strings.EqualFold(m.Type, string(CounterType)):
+			d.valueType = prometheus.CounterValue
+		case strings.EqualFold(m.Type, string(HistogramType)):
+			d.histogram = true
+		default:
+			return fmt.Errorf("unsupported metric type: %s", m.Type)
+		}
+		c.descs[m.Name] = d
+	}
+	// A scratch registry validates metric and label names
+	if err := prometheus.NewRegistry().Register(c); err != nil {
+		fmt.Printf("Failed to register metrics of %s: %v\n", name, err)
+		return err
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	// Metric names must stay unique since nothing checks them before a scrape
+	for other, oc := range collectors {
+		if other == name {
+			continue
+		}
+		for metric := range c.descs {
+			if _, taken := oc.descs[metric]; taken {
+				return fmt.Errorf("metric %s is already exported by %s", metric, other)
 			}
-		} else {
-			fmt.Println("No counters currently registered")
 		}
 	}
+	collectors[name] = c
+	return nil
 }
 
-const (
-	DefaultPrometheusPort = "9095"
-)
+// UnregisterProgram removes the metrics of a program from Prometheus
+func UnregisterProgram(name string) {
+	lock.Lock()
+	defer lock.Unlock()
+	delete(collectors, name)
+}
 
-// StartPrometheusServer starts the Prometheus HTTP server on the specified port
-func StartPrometheusServer(port string) {
-	http.Handle("/metrics", promhttp.Handler())
-	// Use the provided port or default to 9095 if empty
-	if port == "" {
-		port = DefaultPrometheusPort
-	}
-	serverAddr := ":" + port
-	fmt.Printf("Starting Prometheus metrics server on %s/metrics\n", serverAddr)
+// DefaultMetricsAddr is the default listen address of the metrics server
+const DefaultMetricsAddr = ":9095"
 
-	if err := http.ListenAndServe(serverAddr, nil); err != nil {
-		fmt.Printf("Failed to start Prometheus server: %v\n", err)
-	}
+// Handler returns the handler serving /metrics
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return mux
 }
 
 type MetricType string
 
 const (
-	GaugeType   MetricType = "Gauge"
-	CounterType MetricType = "Counter"
+	GaugeType     MetricType = "Gauge"
+	CounterType   MetricType = "Counter"
+	HistogramType MetricType = "Histogram"
 )
 
 var (
 	Node string
 )
-
-func RegisterMetric(name string, help string, bpfType string, labels []string) error {
-	labels = append(labels, Node)
-	switch bpfType {
-	case string(GaugeType):
-		return RegisterGauge(name, help, labels)
-	case string(CounterType):
-		return RegisterCounter(name, help, labels)
-	default:
-		return fmt.Errorf("unsupported metric type: %s", bpfType)
-	}
-}
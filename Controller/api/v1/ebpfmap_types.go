@@ -17,6 +17,7 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -24,17 +25,18 @@ import (
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
 // EbpfMapSpec defines the desired state of EbpfMap.
+// +kubebuilder:validation:XValidation:rule="!has(oldSelf.name) || (has(self.name) && self.name == oldSelf.name)",message="name is immutable"
 type EbpfMapSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	//ebpf代码的名称
+	//ebpf代码的名称，设置后不可修改
 	Name string `json:"name,omitempty"`
 
 	//ebpf 代码部署的挂载点
 	Target string `json:"target,omitempty"`
 
-	//ebpf 代码的类型
+	//ebpf 代码的类型，为空时根据程序的 ELF section 名称推断
 	Type string `json:"type,omitempty"`
 
 	//ebpf 具体的代码
@@ -51,6 +53,146 @@ type EbpfMapSpec struct {
 
 	//ebpf maps 具体的名称
 	Map string `json:"map,omitempty"`
+
+	//uprobe 只对该进程生效，为空时对所有进程生效
+	// +optional
+	PID int32 `json:"pid,omitempty"`
+
+	//uprobe 目标二进制所在的容器 ID，路径会在该容器的挂载命名空间中解析
+	// +optional
+	ContainerID string `json:"containerId,omitempty"`
+
+	//cgroup 程序的挂载钩子，如 ingress、egress、connect4、sock_ops、sysctl、device，为空时根据 ELF section 名称推断
+	// +optional
+	CgroupAttach string `json:"cgroupAttach,omitempty"`
+
+	//同一个 ebpf 对象中需要一起挂载的多个程序，设置后忽略 program、type、target、pid、containerId、cgroupAttach
+	// 任意一个程序挂载失败时已挂载的程序会全部回滚
+	// +optional
+	Attachments []EbpfAttachment `json:"attachments,omitempty"`
+
+	//map key 中作为 prometheus label 的字段（根据 BTF 解析，嵌套字段用 . 连接），为空时整个 key 作为 key label
+	// +optional
+	KeyFields []string `json:"keyFields,omitempty"`
+
+	//map value 中各字段对应的 prometheus 指标，为空时整个 value 作为名称为 name 的指标
+	// +optional
+	Metrics []EbpfMetric `json:"metrics,omitempty"`
+
+	//per-CPU map 各 CPU 值的聚合方式：sum（默认）、max、min、avg，cpu 表示不聚合而是添加 cpu label
+	// +kubebuilder:validation:Enum=sum;max;min;avg;cpu
+	// +optional
+	Aggregation string `json:"aggregation,omitempty"`
+
+	//prometheusType 为 Histogram 时 map 中直方图桶的布局
+	// +optional
+	Histogram *EbpfHistogram `json:"histogram,omitempty"`
+
+	//map 为 ring buffer 或 perf event array 时按记录计数，而不是读取 map 中的值
+	// +optional
+	Events *EbpfEvents `json:"events,omitempty"`
+
+	//Adapter 在后台读取 map 的间隔（至少 1s，各节点会加入随机抖动），为空时在 prometheus 抓取时读取
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	//单次读取 map 的超时时间，默认 5s
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	//只在标签全部匹配的节点上运行，为空时在所有节点上运行
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	//节点亲和性，节点需满足任意一个 nodeSelectorTerms，节点标签变化后会重新选择节点
+	// +optional
+	NodeAffinity *corev1.NodeSelector `json:"nodeAffinity,omitempty"`
+
+	//容忍的节点污点，带有未被容忍的 NoSchedule 或 NoExecute 污点的节点上不会运行
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+}
+
+// EbpfEvents describes the records a program submits to a ring buffer or perf event array.
+type EbpfEvents struct {
+	//记录的 BTF 类型名称，如 event，为空时记录不解析字段
+	// +optional
+	RecordType string `json:"recordType,omitempty"`
+
+	//是否通过 Adapter 的 /events/<name> 以 SSE 推送每条解析后的记录
+	// +optional
+	Stream bool `json:"stream,omitempty"`
+}
+
+// EbpfHistogram describes a map of bucket counters indexed by slot, as filled by the bcc log2 and linear hist helpers.
+type EbpfHistogram struct {
+	//桶的布局：log2（默认，第 i 个桶统计不大于 2^i-1 的值）或 linear
+	// +kubebuilder:validation:Enum=log2;linear
+	// +optional
+	Buckets string `json:"buckets,omitempty"`
+
+	//linear 直方图第一个桶的下界
+	// +optional
+	Min int64 `json:"min,omitempty"`
+
+	//linear 直方图每个桶的宽度
+	// +optional
+	Step int64 `json:"step,omitempty"`
+
+	//map key 中表示桶序号的字段，为空时整个 key 即为桶序号
+	// +optional
+	SlotField string `json:"slotField,omitempty"`
+
+	//保存观测值总和的 map 名称，key 与 keyFields 对应，为空时 _sum 导出为 0
+	// +optional
+	SumMap string `json:"sumMap,omitempty"`
+
+	//桶边界和总和的缩放系数，如 1e-9 表示将纳秒转换为秒
+	// +optional
+	Scale string `json:"scale,omitempty"`
+}
+
+// EbpfMetric maps a field of the map value to a Prometheus metric.
+type EbpfMetric struct {
+	//prometheus 指标名称
+	Name string `json:"name"`
+
+	//prometheus-help 中的内容
+	// +optional
+	Help string `json:"help,omitempty"`
+
+	//prometheus 指标类型，如 Counter、Gauge
+	Type string `json:"type"`
+
+	//map value 中的字段名称，嵌套字段用 . 连接，value 为标量时为空
+	// +optional
+	Field string `json:"field,omitempty"`
+}
+
+// EbpfAttachment describes one program of the eBPF object and where to attach it.
+type EbpfAttachment struct {
+	//ebpf 程序里写的名称
+	Program string `json:"program"`
+
+	//ebpf 程序的类型，为空时根据程序的 ELF section 名称推断
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	//ebpf 程序的挂载点
+	// +optional
+	Target string `json:"target,omitempty"`
+
+	//uprobe 只对该进程生效，为空时对所有进程生效
+	// +optional
+	PID int32 `json:"pid,omitempty"`
+
+	//uprobe 目标二进制所在的容器 ID
+	// +optional
+	ContainerID string `json:"containerId,omitempty"`
+
+	//cgroup 程序的挂载钩子
+	// +optional
+	CgroupAttach string `json:"cgroupAttach,omitempty"`
 }
 
 // EbpfMapStatus defines the observed state of EbpfMap.
@@ -63,7 +205,7 @@ type EbpfMapStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	// Phase 表示 EbpfMap 资源的整体状态
-	// 可能的值: Pending, Deploying, Running, Failed, Terminating
+	// 可能的值: Pending, Deploying, Running, Degraded, Failed, Terminating
 	// +optional
 	Phase string `json:"phase,omitempty"`
 
@@ -83,6 +225,10 @@ type EbpfMapStatus struct {
 	// +optional
 	NodeCount int32 `json:"nodeCount,omitempty"`
 
+	// Nodes 表示 EbpfMap 所选每个节点上程序的加载和指标注册情况
+	// +optional
+	Nodes []EbpfNodeStatus `json:"nodes,omitempty"`
+
 	// LastSuccessfulUpdate 记录最后一次成功更新的时间戳
 	// +optional
 	LastSuccessfulUpdate metav1.Time `json:"lastSuccessfulUpdate,omitempty"`
@@ -94,6 +240,51 @@ type EbpfMapStatus struct {
 	// ErrorMessage 记录最近的错误信息，如果有的话
 	// +optional
 	ErrorMessage string `json:"errorMessage,omitempty"`
+
+	// Teardown 记录删除 EbpfMap 时各节点卸载程序、注销指标的进度
+	// +optional
+	Teardown []EbpfNodeTeardown `json:"teardown,omitempty"`
+}
+
+// EbpfNodeStatus is the state of the program on one node.
+type EbpfNodeStatus struct {
+	// Node 节点名称
+	Node string `json:"node"`
+
+	// Loaded 表示 Loader 已加载并挂载当前版本的程序
+	Loaded bool `json:"loaded"`
+
+	// Registered 表示 Adapter 已注册当前版本的指标
+	Registered bool `json:"registered"`
+
+	// ProgramIDs 记录已挂载程序在该节点内核中的 ID
+	// +optional
+	ProgramIDs []uint32 `json:"programIds,omitempty"`
+
+	// LastError 记录该节点最近一次加载或注册失败的原因
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+
+	// LastTransitionTime 记录 Loaded 或 Registered 最近一次变化的时间
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// EbpfNodeTeardown is the teardown progress of one node.
+type EbpfNodeTeardown struct {
+	// Node 节点名称
+	Node string `json:"node"`
+
+	// Done 表示该节点已确认卸载程序并注销指标，或节点已不存在
+	Done bool `json:"done"`
+
+	// Error 记录最近一次卸载失败的原因
+	// +optional
+	Error string `json:"error,omitempty"`
+
+	// LastAttempt 记录最近一次尝试卸载的时间
+	// +optional
+	LastAttempt metav1.Time `json:"lastAttempt,omitempty"`
 }
 
 // +kubebuilder:object:root=true
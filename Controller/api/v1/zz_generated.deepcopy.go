@@ -21,16 +21,62 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EbpfAttachment) DeepCopyInto(out *EbpfAttachment) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EbpfAttachment.
+func (in *EbpfAttachment) DeepCopy() *EbpfAttachment {
+	if in == nil {
+		return nil
+	}
+	out := new(EbpfAttachment)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EbpfEvents) DeepCopyInto(out *EbpfEvents) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EbpfEvents.
+func (in *EbpfEvents) DeepCopy() *EbpfEvents {
+	if in == nil {
+		return nil
+	}
+	out := new(EbpfEvents)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EbpfHistogram) DeepCopyInto(out *EbpfHistogram) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EbpfHistogram.
+func (in *EbpfHistogram) DeepCopy() *EbpfHistogram {
+	if in == nil {
+		return nil
+	}
+	out := new(EbpfHistogram)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EbpfMap) DeepCopyInto(out *EbpfMap) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -87,6 +133,60 @@ func (in *EbpfMapList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EbpfMapSpec) DeepCopyInto(out *EbpfMapSpec) {
 	*out = *in
+	if in.Attachments != nil {
+		in, out := &in.Attachments, &out.Attachments
+		*out = make([]EbpfAttachment, len(*in))
+		copy(*out, *in)
+	}
+	if in.KeyFields != nil {
+		in, out := &in.KeyFields, &out.KeyFields
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Metrics != nil {
+		in, out := &in.Metrics, &out.Metrics
+		*out = make([]EbpfMetric, len(*in))
+		copy(*out, *in)
+	}
+	if in.Histogram != nil {
+		in, out := &in.Histogram, &out.Histogram
+		*out = new(EbpfHistogram)
+		**out = **in
+	}
+	if in.Events != nil {
+		in, out := &in.Events, &out.Events
+		*out = new(EbpfEvents)
+		**out = **in
+	}
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.NodeAffinity != nil {
+		in, out := &in.NodeAffinity, &out.NodeAffinity
+		*out = new(corev1.NodeSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EbpfMapSpec.
@@ -109,6 +209,33 @@ func (in *EbpfMapStatus) DeepCopyInto(out *EbpfMapStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.RunningNodes != nil {
+		in, out := &in.RunningNodes, &out.RunningNodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]EbpfNodeStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.LastSuccessfulUpdate.DeepCopyInto(&out.LastSuccessfulUpdate)
+	if in.Metrics != nil {
+		in, out := &in.Metrics, &out.Metrics
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Teardown != nil {
+		in, out := &in.Teardown, &out.Teardown
+		*out = make([]EbpfNodeTeardown, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EbpfMapStatus.
@@ -120,3 +247,55 @@ func (in *EbpfMapStatus) DeepCopy() *EbpfMapStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EbpfMetric) DeepCopyInto(out *EbpfMetric) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EbpfMetric.
+func (in *EbpfMetric) DeepCopy() *EbpfMetric {
+	if in == nil {
+		return nil
+	}
+	out := new(EbpfMetric)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EbpfNodeStatus) DeepCopyInto(out *EbpfNodeStatus) {
+	*out = *in
+	if in.ProgramIDs != nil {
+		in, out := &in.ProgramIDs, &out.ProgramIDs
+		*out = make([]uint32, len(*in))
+		copy(*out, *in)
+	}
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EbpfNodeStatus.
+func (in *EbpfNodeStatus) DeepCopy() *EbpfNodeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(EbpfNodeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EbpfNodeTeardown) DeepCopyInto(out *EbpfNodeTeardown) {
+	*out = *in
+	in.LastAttempt.DeepCopyInto(&out.LastAttempt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EbpfNodeTeardown.
+func (in *EbpfNodeTeardown) DeepCopy() *EbpfNodeTeardown {
+	if in == nil {
+		return nil
+	}
+	out := new(EbpfNodeTeardown)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -26,11 +26,15 @@ import (
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
@@ -64,6 +68,8 @@ func main() {
 	var secureMetrics bool
 	var enableHTTP2 bool
 	var tlsOpts []func(*tls.Config)
+	var agentNamespace, agentSelector string
+	var loaderPort, adapterPort int
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
@@ -81,6 +87,12 @@ func main() {
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics Loader key file.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.StringVar(&agentNamespace, "agent-namespace", "",
+		"Namespace of the Loader and Adapter DaemonSet pods. Leave empty to search all namespaces.")
+	flag.StringVar(&agentSelector, "agent-selector", controller.DefaultAgentSelector,
+		"Label selector matching the Loader and Adapter DaemonSet pods, told apart by the "+controller.ComponentLabel+" label.")
+	flag.IntVar(&loaderPort, "loader-port", controller.DefaultLoaderPort, "The port the Loader listens on.")
+	flag.IntVar(&adapterPort, "adapter-port", controller.DefaultAdapterPort, "The port the Adapter API listens on.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -178,8 +190,22 @@ func main() {
 		})
 	}
 
+	agentLabels, err := labels.Parse(agentSelector)
+	if err != nil {
+		setupLog.Error(err, "invalid agent selector")
+		os.Exit(1)
+	}
+	// Only the node agent pods are cached, not every pod in the cluster
+	agentCache := cache.ByObject{Label: agentLabels}
+	if agentNamespace != "" {
+		agentCache.Namespaces = map[string]cache.Config{agentNamespace: {}}
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
+		Scheme: scheme,
+		Cache: cache.Options{
+			ByObject: map[client.Object]cache.ByObject{&corev1.Pod{}: agentCache},
+		},
 		Metrics:                metricsServerOptions,
 		WebhookServer:          webhookServer,
 		HealthProbeBindAddress: probeAddr,
@@ -202,9 +228,11 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controller.EbpfMapReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+	if err = controller.NewEbpfMapReconciler(mgr.GetClient(), mgr.GetScheme(), controller.AgentDiscovery{
+		Namespace:   agentNamespace,
+		Selector:    agentLabels,
+		LoaderPort:  loaderPort,
+		AdapterPort: adapterPort,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "EbpfMap")
 		os.Exit(1)
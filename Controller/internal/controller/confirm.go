@@ -0,0 +1,133 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	ebpfv1 "github.com/bearslyricattack/ebpf-controller/api/v1"
+	"github.com/go-logr/logr"
+)
+
+// loaderProgram is the part of a program reported by the Loader the controller uses
+type loaderProgram struct {
+	SourceHash  string `json:"sourceHash"`
+	Attachments []struct {
+		ProgramID uint32 `json:"programId"`
+	} `json:"attachments"`
+}
+
+// programIDs returns the kernel IDs of the attached programs
+func (p *loaderProgram) programIDs() []uint32 {
+	var ids []uint32
+	for _, a := range p.Attachments {
+		if a.ProgramID != 0 {
+			ids = append(ids, a.ProgramID)
+		}
+	}
+	return ids
+}
+
+// confirmLoaded asks the Loader of every node with an unconfirmed load
+// whether it still runs the current source. Nodes that do are not loaded
+// again; their metrics are only registered again if the Loader had to reload
+// the program, which shows up as new program IDs.
+func (r *EbpfMapReconciler) confirmLoaded(ctx context.Context, ebpfMap *ebpfv1.EbpfMap, agents map[string]*nodeAgent, states map[string]*nodeState, logger logr.Logger) {
+	hash := sourceHash(ebpfMap.Spec.Code)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for node, agent := range agents {
+		if !states[node].unconfirmed {
+			continue
+		}
+		wg.Add(1)
+		go func(agent *nodeAgent, state *nodeState) {
+			defer wg.Done()
+			nodeLogger := logger.WithValues("node", agent.Node)
+			program, err := fetchLoaderProgram(ctx, agent.StatusURL+url.PathEscape(ebpfMap.Spec.Name))
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				// Checked again on the next retry, the node is not reloaded meanwhile
+				nodeLogger.Error(err, "Failed to query the Loader")
+				state.lastError = "status: " + err.Error()
+				return
+			}
+			state.unconfirmed = false
+			if program == nil || program.SourceHash != hash {
+				nodeLogger.Info("Loader does not run the current source, loading again")
+				state.loaded = false
+				state.registered = false
+				state.programIDs = nil
+				return
+			}
+			ids := program.programIDs()
+			if !slices.Equal(ids, state.programIDs) {
+				state.registered = false
+			}
+			state.programIDs = ids
+			state.lastError = ""
+		}(agent, states[node])
+	}
+	wg.Wait()
+}
+
+// fetchLoaderProgram returns the program the Loader reports at statusURL, or
+// nil if the Loader does not know it
+func fetchLoaderProgram(ctx context.Context, statusURL string) (*loaderProgram, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, statusURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, responseError(statusURL, resp.StatusCode, body)
+	}
+	var program loaderProgram
+	if err := json.Unmarshal(body, &program); err != nil {
+		return nil, err
+	}
+	return &program, nil
+}
+
+// sourceHash returns the hex encoded SHA-256 of the program source, as the Loader records it
+func sourceHash(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+
+	ebpfv1 "github.com/bearslyricattack/ebpf-controller/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Labels telling the Loader and Adapter pods of the node agent DaemonSets apart
+const (
+	ComponentLabel   = "app.kubernetes.io/component"
+	ComponentLoader  = "loader"
+	ComponentAdapter = "adapter"
+)
+
+// Default ports of the node agents
+const (
+	DefaultLoaderPort  = 8082
+	DefaultAdapterPort = 8080
+)
+
+// DefaultAgentSelector selects the pods of both node agent DaemonSets
+const DefaultAgentSelector = "app.kubernetes.io/part-of=ebpforge"
+
+// AgentDiscovery describes how to find the Loader and Adapter pods that the
+// node agent DaemonSets run on every node
+type AgentDiscovery struct {
+	// Namespace of the agent pods, empty for all namespaces
+	Namespace string
+	// Selector matches the pods of both DaemonSets, ComponentLabel tells them apart
+	Selector    labels.Selector
+	LoaderPort  int
+	AdapterPort int
+}
+
+// nodeAgent holds the endpoints of the Loader and Adapter running on one node
+type nodeAgent struct {
+	Node          string
+	LoadURL       string
+	UnloadURL     string
+	RegisterURL   string
+	UnregisterURL string
+	// StatusURL reports a loaded program once its name is appended
+	StatusURL string
+	// LoaderID and AdapterID change when the pod is replaced
+	LoaderID  string
+	AdapterID string
+}
+
+// discoverAgents returns the nodes whose Loader and Adapter pods are both
+// ready, keyed by node name
+func (r *EbpfMapReconciler) discoverAgents(ctx context.Context) (map[string]*nodeAgent, error) {
+	var pods corev1.PodList
+	opts := []client.ListOption{client.MatchingLabelsSelector{Selector: r.agentSelector()}}
+	if r.Agents.Namespace != "" {
+		opts = append(opts, client.InNamespace(r.Agents.Namespace))
+	}
+	if err := r.List(ctx, &pods, opts...); err != nil {
+		return nil, fmt.Errorf("failed to list agent pods: %w", err)
+	}
+	loaders := make(map[string]*corev1.Pod)
+	adapters := make(map[string]*corev1.Pod)
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !agentReady(pod) {
+			continue
+		}
+		switch pod.Labels[ComponentLabel] {
+		case ComponentLoader:
+			loaders[pod.Spec.NodeName] = pod
+		case ComponentAdapter:
+			adapters[pod.Spec.NodeName] = pod
+		}
+	}
+	agents := make(map[string]*nodeAgent)
+	for node, loader := range loaders {
+		adapter, ok := adapters[node]
+		if !ok {
+			continue
+		}
+		loaderBase := "http://" + net.JoinHostPort(loader.Status.PodIP, strconv.Itoa(r.Agents.LoaderPort))
+		adapterBase := "http://" + net.JoinHostPort(adapter.Status.PodIP, strconv.Itoa(r.Agents.AdapterPort))
+		agents[node] = &nodeAgent{
+			Node:          node,
+			LoadURL:       loaderBase + "/v1/programs",
+			UnloadURL:     loaderBase + "/unload",
+			RegisterURL:   adapterBase + "/register",
+			UnregisterURL: adapterBase + "/unregister",
+			StatusURL:     loaderBase + "/status/",
+			LoaderID:      string(loader.UID),
+			AdapterID:     string(adapter.UID),
+		}
+	}
+	return agents, nil
+}
+
+// agentReady reports whether pod is scheduled, has an IP and passes its readiness probe
+func agentReady(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Spec.NodeName == "" || pod.Status.PodIP == "" {
+		return false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// isAgentPod reports whether obj is a pod of the node agent DaemonSets
+func (r *EbpfMapReconciler) isAgentPod(obj client.Object) bool {
+	if r.Agents.Namespace != "" && obj.GetNamespace() != r.Agents.Namespace {
+		return false
+	}
+	return r.agentSelector().Matches(labels.Set(obj.GetLabels()))
+}
+
+// agentSelector returns the configured selector, matching nothing when unset
+func (r *EbpfMapReconciler) agentSelector() labels.Selector {
+	if r.Agents.Selector == nil {
+		return labels.Nothing()
+	}
+	return r.Agents.Selector
+}
+
+// allEbpfMaps requeues every EbpfMap when an agent pod comes or goes, so new
+// nodes receive the existing programs, or when node labels or taints change
+func (r *EbpfMapReconciler) allEbpfMaps(ctx context.Context, _ client.Object) []reconcile.Request {
+	var list ebpfv1.EbpfMapList
+	if err := r.List(ctx, &list); err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, item := range list.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: item.Namespace, Name: item.Name},
+		})
+	}
+	return requests
+}
+
+// sortedNodes returns the node names of agents in order
+func sortedNodes(agents map[string]*nodeAgent) []string {
+	nodes := make([]string, 0, len(agents))
+	for node := range agents {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
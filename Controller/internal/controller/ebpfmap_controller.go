@@ -24,18 +24,26 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	ebpfv1 "github.com/bearslyricattack/ebpf-controller/api/v1"
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
 // Constants for the controller
@@ -49,33 +57,50 @@ const (
 type EbpfMapReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
-	// Configuration that could be injected
-	LoadURLs     []string
-	RegisterURLs []string
+	// Agents locates the Loader and Adapter on every node
+	Agents AgentDiscovery
 	// Cache for tracking retries
 	processedVersions map[string]string
 	retryCount        map[string]int
-	mutex             sync.Mutex
+	// nodes records what has been pushed to each node, per EbpfMap
+	nodes map[types.NamespacedName]map[string]*nodeState
+	mutex sync.Mutex
+}
+
+// nodeState is what the agents of one node have accepted for an EbpfMap
+type nodeState struct {
+	loaderID   string
+	adapterID  string
+	generation int64
+	loaded     bool
+	registered bool
+	// unconfirmed means loaded was carried over from an earlier controller
+	// run or a replaced Loader and is checked with the Loader before relying on it
+	unconfirmed bool
+	// programIDs are the kernel IDs the Loader reported for the attached programs
+	programIDs []uint32
+	// lastError is why the last load or registration on the node failed
+	lastError string
 }
 
 // Initialize creates a new EbpfMapReconciler with default values
-func NewEbpfMapReconciler(client client.Client, scheme *runtime.Scheme) *EbpfMapReconciler {
+func NewEbpfMapReconciler(client client.Client, scheme *runtime.Scheme, agents AgentDiscovery) *EbpfMapReconciler {
 	return &EbpfMapReconciler{
-		Client: client,
-		Scheme: scheme,
-		LoadURLs: []string{
-			"http://192.168.0.53:8082/load",
-			"http://192.168.10.63:8082/load",
-		},
-		RegisterURLs: []string{
-			"http://192.168.0.53:8080/register",
-			"http://192.168.10.63:8080/register",
-		},
+		Client:            client,
+		Scheme:            scheme,
+		Agents:            agents,
 		processedVersions: make(map[string]string),
 		retryCount:        make(map[string]int),
+		nodes:             make(map[types.NamespacedName]map[string]*nodeState),
 	}
 }
 
+// +kubebuilder:rbac:groups=ebpf.github.com,resources=ebpfmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=ebpf.github.com,resources=ebpfmaps/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=ebpf.github.com,resources=ebpfmaps/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+
 // Reconcile handles the reconciliation logic for EbpfMap resources
 func (r *EbpfMapReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx).WithValues("ebpfMap", req.NamespacedName.String())
@@ -86,65 +111,246 @@ func (r *EbpfMapReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	if err := r.Get(ctx, req.NamespacedName, &ebpfMap); err != nil {
 		if errors.IsNotFound(err) {
 			logger.Info("Resource not found, may have been deleted")
+			r.forgetNodes(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		logger.Error(err, "Failed to fetch resource")
 		return ctrl.Result{}, err
 	}
-	loadResult, err := r.processEbpfLoading(ctx, &ebpfMap, logger)
+	if !ebpfMap.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, &ebpfMap, logger)
+	}
+	// The finalizer goes on before anything is loaded so no node is missed on deletion
+	if controllerutil.AddFinalizer(&ebpfMap, teardownFinalizer) {
+		if err := r.Update(ctx, &ebpfMap); err != nil {
+			logger.Error(err, "Failed to add finalizer")
+			return ctrl.Result{}, err
+		}
+	}
+	agents, err := r.discoverAgents(ctx)
+	if err != nil {
+		logger.Error(err, "Failed to discover node agents")
+		return ctrl.Result{}, err
+	}
+	if len(agents) == 0 {
+		// Reconciled again when an agent pod becomes ready
+		logger.Info("No node agents found")
+	}
+	placed, err := r.placeAgents(ctx, &ebpfMap, agents)
+	if err != nil {
+		logger.Error(err, "Failed to select nodes")
+		return ctrl.Result{}, err
+	}
+	states, removed := r.syncNodes(req.NamespacedName, &ebpfMap, placed)
+	r.confirmLoaded(ctx, &ebpfMap, placed, states, logger)
+	// Unload from nodes that no longer match, including those recorded by an earlier controller run
+	stale, unreachable := r.staleNodes(ctx, &ebpfMap, removed, placed, agents)
+	failed := r.teardownNodes(ctx, ebpfMap.Spec.Name, stale, logger)
+	loadResult, err := r.processEbpfLoading(ctx, &ebpfMap, placed, states, logger)
 	if err != nil {
 		return loadResult, err
 	}
-	registerResult, err := r.processMetricRegistration(ctx, &ebpfMap, logger)
+	registerResult, err := r.processMetricRegistration(ctx, &ebpfMap, placed, states, logger)
 	if err != nil {
 		return registerResult, err
 	}
+	setRunningNodes(&ebpfMap, states, failed, unreachable)
+	healthy := setNodeStatus(&ebpfMap, states)
 	if err := r.Status().Update(ctx, &ebpfMap); err != nil {
 		logger.Error(err, "Failed to update status")
 		return ctrl.Result{Requeue: true}, err
 	}
-	logger.Info("Reconciliation completed successfully")
+	if !healthy || len(failed) > 0 {
+		logger.Info("Reconciliation incomplete, retrying", "phase", ebpfMap.Status.Phase, "error", ebpfMap.Status.ErrorMessage)
+		return ctrl.Result{RequeueAfter: nodeRetryInterval}, nil
+	}
+	logger.Info("Reconciliation completed successfully", "phase", ebpfMap.Status.Phase)
 	return ctrl.Result{}, nil
 }
 
-// processEbpfLoading handles the loading of eBPF programs
-func (r *EbpfMapReconciler) processEbpfLoading(ctx context.Context, ebpfMap *ebpfv1.EbpfMap, logger logr.Logger) (ctrl.Result, error) {
-	logger.Info("Starting eBPF program loading", "targets", len(r.LoadURLs))
+// syncNodes returns the push state of every node the EbpfMap is placed on.
+// Nodes that are no longer placed are forgotten and returned if they had
+// loaded the program. Nodes holding an older generation of the spec start
+// over, nodes whose Adapter was replaced only register the metrics again, and
+// nodes first seen by this controller run take their state from the status.
+func (r *EbpfMapReconciler) syncNodes(key types.NamespacedName, ebpfMap *ebpfv1.EbpfMap, placed map[string]*nodeAgent) (map[string]*nodeState, []string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.nodes == nil {
+		r.nodes = make(map[types.NamespacedName]map[string]*nodeState)
+	}
+	states := r.nodes[key]
+	if states == nil {
+		states = make(map[string]*nodeState)
+		r.nodes[key] = states
+	}
+	var removed []string
+	for node, state := range states {
+		if _, ok := placed[node]; !ok {
+			if state.loaded {
+				removed = append(removed, node)
+			}
+			delete(states, node)
+		}
+	}
+	for node, agent := range placed {
+		state, ok := states[node]
+		switch {
+		case !ok:
+			state = recordedState(ebpfMap, node)
+		case state.generation != ebpfMap.Generation:
+			state = &nodeState{generation: ebpfMap.Generation}
+		default:
+			if state.loaderID != agent.LoaderID {
+				// A new Loader restores its programs from their pins
+				state.unconfirmed = state.loaded
+			}
+			if state.adapterID != agent.AdapterID {
+				state.registered = false
+			}
+		}
+		state.loaderID = agent.LoaderID
+		state.adapterID = agent.AdapterID
+		states[node] = state
+	}
+	return states, removed
+}
+
+// recordedState rebuilds the state of a node from the status an earlier
+// controller run wrote for the current generation
+func recordedState(ebpfMap *ebpfv1.EbpfMap, node string) *nodeState {
+	state := &nodeState{generation: ebpfMap.Generation}
+	loaded := meta.FindStatusCondition(ebpfMap.Status.Conditions, conditionTypeLoaded)
+	if loaded == nil || loaded.ObservedGeneration != ebpfMap.Generation {
+		return state
+	}
+	for _, status := range ebpfMap.Status.Nodes {
+		if status.Node == node && status.Loaded {
+			state.loaded = true
+			state.unconfirmed = true
+			state.registered = status.Registered
+			state.programIDs = status.ProgramIDs
+		}
+	}
+	return state
+}
+
+// staleNodes returns the agents of nodes that still run the program but are
+// no longer placed, and the names of such nodes whose agents are unreachable
+func (r *EbpfMapReconciler) staleNodes(ctx context.Context, ebpfMap *ebpfv1.EbpfMap, removed []string, placed map[string]*nodeAgent, agents map[string]*nodeAgent) ([]*nodeAgent, []string) {
+	var stale []*nodeAgent
+	var unreachable []string
+	seen := make(map[string]bool)
+	for _, node := range append(append([]string(nil), ebpfMap.Status.RunningNodes...), removed...) {
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+		if _, ok := placed[node]; ok {
+			continue
+		}
+		if agent, ok := agents[node]; ok {
+			stale = append(stale, agent)
+		} else if r.nodeExists(ctx, node) {
+			// Torn down once the node's agents are back
+			unreachable = append(unreachable, node)
+		}
+	}
+	return stale, unreachable
+}
+
+// setRunningNodes records the nodes the program is loaded on, including
+// nodes it could not be unloaded from yet
+func setRunningNodes(ebpfMap *ebpfv1.EbpfMap, states map[string]*nodeState, failed map[string]error, unreachable []string) {
+	running := append([]string(nil), unreachable...)
+	for node, state := range states {
+		if state.loaded {
+			running = append(running, node)
+		}
+	}
+	for node := range failed {
+		running = append(running, node)
+	}
+	sort.Strings(running)
+	ebpfMap.Status.RunningNodes = running
+	ebpfMap.Status.NodeCount = int32(len(running))
+}
+
+// forgetNodes drops the push state of a deleted EbpfMap
+func (r *EbpfMapReconciler) forgetNodes(key types.NamespacedName) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.nodes, key)
+}
+
+// processEbpfLoading loads the eBPF program on every node that does not run the current spec yet
+func (r *EbpfMapReconciler) processEbpfLoading(ctx context.Context, ebpfMap *ebpfv1.EbpfMap, agents map[string]*nodeAgent, states map[string]*nodeState, logger logr.Logger) (ctrl.Result, error) {
+	var pending []*nodeAgent
+	for _, node := range sortedNodes(agents) {
+		if !states[node].loaded {
+			pending = append(pending, agents[node])
+		}
+	}
+	logger.Info("Starting eBPF program loading", "targets", len(pending), "nodes", len(agents))
 	successCount := 0
-	totalURLs := len(r.LoadURLs)
+	totalURLs := len(pending)
+	loadPayload := map[string]interface{}{
+		"name": ebpfMap.Spec.Name,
+		"code": ebpfMap.Spec.Code,
+		"options": map[string]interface{}{
+			"replace": true,
+		},
+	}
+	// The Loader accepts either a list of attachments or a single inline one
+	if len(ebpfMap.Spec.Attachments) > 0 {
+		loadPayload["attachments"] = ebpfMap.Spec.Attachments
+	} else {
+		loadPayload["target"] = ebpfMap.Spec.Target
+		loadPayload["type"] = ebpfMap.Spec.Type
+		loadPayload["program"] = ebpfMap.Spec.Program
+		loadPayload["pid"] = ebpfMap.Spec.PID
+		loadPayload["containerId"] = ebpfMap.Spec.ContainerID
+		loadPayload["cgroupAttach"] = ebpfMap.Spec.CgroupAttach
+	}
+	jsonPayload, err := json.Marshal(loadPayload)
+	if err != nil {
+		logger.Error(err, "Failed to marshal load payload")
+		return ctrl.Result{Requeue: true}, err
+	}
 	// Use a WaitGroup to process requests concurrently
 	var wg sync.WaitGroup
 	var mu sync.Mutex
-	for i, baseURL := range r.LoadURLs {
+	for i, agent := range pending {
 		wg.Add(1)
-		go func(index int, loadURL string) {
+		go func(index int, agent *nodeAgent) {
 			defer wg.Done()
-			host := extractHostFromURL(loadURL)
-			urlLogger := logger.WithValues("host", host, "index", index+1, "total", totalURLs)
-			// Construct URL with parameters
-			fullURL := fmt.Sprintf("%s?name=%s&target=%s&type=%s&code=%s&program=%s",
-				loadURL,
-				url.QueryEscape(ebpfMap.Spec.Name),
-				url.QueryEscape(ebpfMap.Spec.Target),
-				url.QueryEscape(ebpfMap.Spec.Type),
-				url.QueryEscape(ebpfMap.Spec.Code),
-				url.QueryEscape(ebpfMap.Spec.Program))
-			req, err := http.NewRequestWithContext(ctx, http.MethodGet, fullURL, nil)
+			host := extractHostFromURL(agent.LoadURL)
+			urlLogger := logger.WithValues("node", agent.Node, "host", host, "index", index+1, "total", totalURLs)
+			fail := func(err error) {
+				mu.Lock()
+				states[agent.Node].lastError = "load: " + err.Error()
+				mu.Unlock()
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, agent.LoadURL, bytes.NewReader(jsonPayload))
 			if err != nil {
 				urlLogger.Error(err, "Failed to create request")
+				fail(err)
 				return
 			}
+			req.Header.Set("Content-Type", "application/json")
 			client := &http.Client{Timeout: 10 * time.Second}
 			urlLogger.V(1).Info("Sending load request")
 			resp, err := client.Do(req)
 			if err != nil {
 				urlLogger.Error(err, "Failed to send load request")
+				fail(err)
 				return
 			}
 			defer resp.Body.Close()
 			body, err := io.ReadAll(resp.Body)
 			if err != nil {
 				urlLogger.Error(err, "Failed to read response")
+				fail(err)
 				return
 			}
 			responseStatus := resp.StatusCode
@@ -155,43 +361,109 @@ func (r *EbpfMapReconciler) processEbpfLoading(ctx context.Context, ebpfMap *ebp
 			if resp.StatusCode == http.StatusOK {
 				mu.Lock()
 				successCount++
+				states[agent.Node].loaded = true
+				states[agent.Node].lastError = ""
+				states[agent.Node].programIDs = loadedProgramIDs(body)
 				mu.Unlock()
 				urlLogger.Info("Load successful")
 			} else {
 				urlLogger.Info("Load failed", "statusCode", resp.StatusCode, "response", string(body))
+				fail(responseError(agent.LoadURL, resp.StatusCode, body))
 			}
-		}(i, baseURL)
+		}(i, agent)
 	}
 	wg.Wait()
-	condition := metav1.Condition{
-		Type:               conditionTypeLoaded,
-		Status:             metav1.ConditionTrue,
-		LastTransitionTime: metav1.Now(),
-		Reason:             "LoadSuccess",
-		Message:            fmt.Sprintf("Successfully loaded eBPF program on %d/%d targets", successCount, totalURLs),
-	}
-	meta.SetStatusCondition(&ebpfMap.Status.Conditions, condition)
 	logger.Info("Load processing complete",
 		"successCount", successCount,
 		"totalURLs", totalURLs)
-	if successCount == 0 {
-		return ctrl.Result{Requeue: true}, fmt.Errorf("failed to process any load requests successfully")
-	}
 	return ctrl.Result{}, nil
 }
 
-// processMetricRegistration handles the registration of metrics
-func (r *EbpfMapReconciler) processMetricRegistration(ctx context.Context, ebpfMap *ebpfv1.EbpfMap, logger logr.Logger) (ctrl.Result, error) {
-	logger.Info("Starting metric registration", "targets", len(r.RegisterURLs))
+// loadedProgramIDs returns the kernel IDs of the attached programs reported
+// in a Loader response
+func loadedProgramIDs(body []byte) []uint32 {
+	var resp struct {
+		Program loaderProgram `json:"program"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil
+	}
+	return resp.Program.programIDs()
+}
+
+// mapPinPath returns where the Loader pins a map of the named program
+func mapPinPath(name string, mapName string) string {
+	return "/sys/fs/bpf/" + name + "/" + mapName
+}
+
+// histogramPayload converts a histogram spec into the Adapter's registration format
+func histogramPayload(name string, h *ebpfv1.EbpfHistogram) (map[string]interface{}, error) {
+	payload := map[string]interface{}{
+		"buckets":   h.Buckets,
+		"min":       h.Min,
+		"step":      h.Step,
+		"slotField": h.SlotField,
+	}
+	if h.SumMap != "" {
+		payload["sumPath"] = mapPinPath(name, h.SumMap)
+	}
+	if h.Scale != "" {
+		scale, err := strconv.ParseFloat(h.Scale, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid histogram scale %q: %w", h.Scale, err)
+		}
+		payload["scale"] = scale
+	}
+	return payload, nil
+}
+
+// processMetricRegistration registers the metrics on every node that loaded the program but has not registered them yet
+func (r *EbpfMapReconciler) processMetricRegistration(ctx context.Context, ebpfMap *ebpfv1.EbpfMap, agents map[string]*nodeAgent, states map[string]*nodeState, logger logr.Logger) (ctrl.Result, error) {
+	var pending []*nodeAgent
+	for _, node := range sortedNodes(agents) {
+		if states[node].loaded && !states[node].registered {
+			pending = append(pending, agents[node])
+		}
+	}
+	logger.Info("Starting metric registration", "targets", len(pending), "nodes", len(agents))
 
 	registerSuccessCount := 0
-	totalRegisterURLs := len(r.RegisterURLs)
+	totalRegisterURLs := len(pending)
 	registerPayload := map[string]interface{}{
-		"name":   ebpfMap.Spec.Name,
-		"help":   ebpfMap.Spec.Help,
-		"type":   ebpfMap.Spec.PrometheusType,
-		"labels": []string{"key"},
-		"path":   "/sys/fs/bpf/" + ebpfMap.Spec.Name + "/" + ebpfMap.Spec.Map,
+		"name":        ebpfMap.Spec.Name,
+		"help":        ebpfMap.Spec.Help,
+		"type":        ebpfMap.Spec.PrometheusType,
+		"path":        mapPinPath(ebpfMap.Spec.Name, ebpfMap.Spec.Map),
+		"metrics":     ebpfMap.Spec.Metrics,
+		"aggregation": ebpfMap.Spec.Aggregation,
+	}
+	// Key fields double as label names, otherwise the whole key is the "key" label.
+	// Histogram keys are bucket slots and event records have no key, so both are only labelled by key fields.
+	isHistogram := strings.EqualFold(ebpfMap.Spec.PrometheusType, "Histogram")
+	if len(ebpfMap.Spec.KeyFields) > 0 {
+		registerPayload["keyFields"] = ebpfMap.Spec.KeyFields
+	} else if !isHistogram && ebpfMap.Spec.Events == nil {
+		registerPayload["labels"] = []string{"key"}
+	}
+	if isHistogram && ebpfMap.Spec.Histogram != nil {
+		histogram, err := histogramPayload(ebpfMap.Spec.Name, ebpfMap.Spec.Histogram)
+		if err != nil {
+			logger.Error(err, "Invalid histogram spec")
+			for _, agent := range pending {
+				states[agent.Node].lastError = "register: " + err.Error()
+			}
+			return ctrl.Result{}, nil
+		}
+		registerPayload["histogram"] = histogram
+	}
+	if ebpfMap.Spec.Events != nil {
+		registerPayload["events"] = ebpfMap.Spec.Events
+	}
+	if ebpfMap.Spec.Interval != nil {
+		registerPayload["interval"] = ebpfMap.Spec.Interval.Duration.String()
+	}
+	if ebpfMap.Spec.Timeout != nil {
+		registerPayload["timeout"] = ebpfMap.Spec.Timeout.Duration.String()
 	}
 
 	// Convert the payload to JSON
@@ -205,20 +477,26 @@ func (r *EbpfMapReconciler) processMetricRegistration(ctx context.Context, ebpfM
 	var wg sync.WaitGroup
 	var mu sync.Mutex // Mutex to protect registerSuccessCount
 
-	for i, registerURL := range r.RegisterURLs {
+	for i, agent := range pending {
 		wg.Add(1)
-		go func(index int, regURL string) {
+		go func(index int, agent *nodeAgent) {
 			defer wg.Done()
 
-			host := extractHostFromURL(regURL)
-			urlLogger := logger.WithValues("host", host, "index", index+1, "total", totalRegisterURLs)
+			host := extractHostFromURL(agent.RegisterURL)
+			urlLogger := logger.WithValues("node", agent.Node, "host", host, "index", index+1, "total", totalRegisterURLs)
 
 			urlLogger.V(1).Info("Sending register request")
+			fail := func(err error) {
+				mu.Lock()
+				states[agent.Node].lastError = "register: " + err.Error()
+				mu.Unlock()
+			}
 
 			// Create a new POST request with context
-			req, err := http.NewRequestWithContext(ctx, http.MethodPost, regURL, bytes.NewBuffer(jsonPayload))
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, agent.RegisterURL, bytes.NewBuffer(jsonPayload))
 			if err != nil {
 				urlLogger.Error(err, "Failed to create register request")
+				fail(err)
 				return
 			}
 
@@ -230,6 +508,7 @@ func (r *EbpfMapReconciler) processMetricRegistration(ctx context.Context, ebpfM
 			resp, err := client.Do(req)
 			if err != nil {
 				urlLogger.Error(err, "Failed to send register request")
+				fail(err)
 				return
 			}
 			defer resp.Body.Close()
@@ -238,6 +517,7 @@ func (r *EbpfMapReconciler) processMetricRegistration(ctx context.Context, ebpfM
 			body, err := io.ReadAll(resp.Body)
 			if err != nil {
 				urlLogger.Error(err, "Failed to read register response")
+				fail(err)
 				return
 			}
 
@@ -250,31 +530,21 @@ func (r *EbpfMapReconciler) processMetricRegistration(ctx context.Context, ebpfM
 			if resp.StatusCode == http.StatusOK {
 				mu.Lock()
 				registerSuccessCount++
+				states[agent.Node].registered = true
+				states[agent.Node].lastError = ""
 				mu.Unlock()
 				urlLogger.Info("Registration successful")
 			} else {
 				urlLogger.Info("Registration failed", "statusCode", resp.StatusCode, "response", string(body))
+				fail(responseError(agent.RegisterURL, resp.StatusCode, body))
 			}
-		}(i, registerURL)
+		}(i, agent)
 	}
 	// Wait for all requests to complete
 	wg.Wait()
-	// Update status to indicate registration status
-	condition := metav1.Condition{
-		Type:               conditionTypeRegistered,
-		Status:             metav1.ConditionTrue,
-		LastTransitionTime: metav1.Now(),
-		Reason:             "RegisterSuccess",
-		Message:            fmt.Sprintf("Successfully registered metrics on %d/%d targets", registerSuccessCount, totalRegisterURLs),
-	}
-	meta.SetStatusCondition(&ebpfMap.Status.Conditions, condition)
 	logger.Info("Registration processing complete",
 		"successCount", registerSuccessCount,
 		"totalURLs", totalRegisterURLs)
-
-	if registerSuccessCount == 0 {
-		return ctrl.Result{Requeue: true}, fmt.Errorf("failed to process any registration requests successfully")
-	}
 	return ctrl.Result{}, nil
 }
 
@@ -291,6 +561,12 @@ func extractHostFromURL(urlStr string) string {
 func (r *EbpfMapReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&ebpfv1.EbpfMap{}).
+		Watches(&corev1.Pod{},
+			handler.EnqueueRequestsFromMapFunc(r.allEbpfMaps),
+			builder.WithPredicates(predicate.NewPredicateFuncs(r.isAgentPod))).
+		Watches(&corev1.Node{},
+			handler.EnqueueRequestsFromMapFunc(r.allEbpfMaps),
+			builder.WithPredicates(nodePlacementChanged)).
 		Named("ebpfmap").
 		Complete(r)
 }
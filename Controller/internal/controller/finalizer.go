@@ -0,0 +1,172 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	ebpfv1 "github.com/bearslyricattack/ebpf-controller/api/v1"
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// teardownFinalizer keeps a deleted EbpfMap until every node has unloaded it
+	teardownFinalizer = "ebpf.github.com/teardown"
+	// forceTeardownAnnotation set to "true" releases a deleted EbpfMap without waiting for its nodes
+	forceTeardownAnnotation = "ebpf.github.com/force-teardown"
+	// teardownTimeoutAnnotation overrides how long a deleted EbpfMap waits for its nodes, e.g. "30m"
+	teardownTimeoutAnnotation = "ebpf.github.com/teardown-timeout"
+	// defaultTeardownTimeout is how long a deleted EbpfMap waits for nodes that cannot be reached
+	defaultTeardownTimeout = 10 * time.Minute
+	// teardownRetryInterval is how often failed nodes are retried
+	teardownRetryInterval = 15 * time.Second
+)
+
+// reconcileDelete unloads the program and unregisters its metrics on every
+// node it ran on and releases the finalizer once all nodes confirmed, the
+// teardown timed out or it was forced
+func (r *EbpfMapReconciler) reconcileDelete(ctx context.Context, ebpfMap *ebpfv1.EbpfMap, logger logr.Logger) (ctrl.Result, error) {
+	key := types.NamespacedName{Namespace: ebpfMap.Namespace, Name: ebpfMap.Name}
+	if !controllerutil.ContainsFinalizer(ebpfMap, teardownFinalizer) {
+		r.forgetNodes(key)
+		return ctrl.Result{}, nil
+	}
+	if len(ebpfMap.Status.Teardown) == 0 {
+		ebpfMap.Status.Teardown = r.teardownPlan(key, ebpfMap.Status.RunningNodes)
+	}
+
+	agents, err := r.discoverAgents(ctx)
+	if err != nil {
+		logger.Error(err, "Failed to discover node agents")
+		return ctrl.Result{}, err
+	}
+	var pending []*nodeAgent
+	now := metav1.Now()
+	for i := range ebpfMap.Status.Teardown {
+		progress := &ebpfMap.Status.Teardown[i]
+		if progress.Done {
+			continue
+		}
+		progress.LastAttempt = now
+		if agent, ok := agents[progress.Node]; ok {
+			pending = append(pending, agent)
+		} else if !r.nodeExists(ctx, progress.Node) {
+			// Nothing runs on a node that left the cluster
+			progress.Done = true
+			progress.Error = ""
+		} else {
+			progress.Error = "node agents are not ready"
+		}
+	}
+	failed := r.teardownNodes(ctx, ebpfMap.Spec.Name, pending, logger)
+	var remaining []string
+	for i := range ebpfMap.Status.Teardown {
+		progress := &ebpfMap.Status.Teardown[i]
+		if progress.Done {
+			continue
+		}
+		if _, ok := agents[progress.Node]; ok {
+			if err, ok := failed[progress.Node]; ok {
+				progress.Error = err.Error()
+			} else {
+				progress.Done = true
+				progress.Error = ""
+			}
+		}
+		if !progress.Done {
+			remaining = append(remaining, progress.Node)
+		}
+	}
+	ebpfMap.Status.RunningNodes = remaining
+	ebpfMap.Status.NodeCount = int32(len(remaining))
+	ebpfMap.Status.Phase = phaseTerminating
+	if err := r.Status().Update(ctx, ebpfMap); err != nil {
+		logger.Error(err, "Failed to update teardown status")
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	if len(remaining) > 0 {
+		if ebpfMap.Annotations[forceTeardownAnnotation] != "true" {
+			timeout := teardownTimeout(ebpfMap, logger)
+			waited := time.Since(ebpfMap.DeletionTimestamp.Time)
+			if waited < timeout {
+				logger.Info("Waiting for nodes to tear down", "nodes", remaining)
+				return ctrl.Result{RequeueAfter: min(teardownRetryInterval, timeout-waited)}, nil
+			}
+		}
+		logger.Info("Releasing EbpfMap without confirmation from all nodes", "nodes", remaining)
+	}
+	controllerutil.RemoveFinalizer(ebpfMap, teardownFinalizer)
+	if err := r.Update(ctx, ebpfMap); err != nil {
+		logger.Error(err, "Failed to remove finalizer")
+		return ctrl.Result{Requeue: true}, err
+	}
+	r.forgetNodes(key)
+	logger.Info("Teardown completed")
+	return ctrl.Result{}, nil
+}
+
+// teardownPlan lists the nodes to tear down: those recorded in status and
+// those this controller loaded the program on since
+func (r *EbpfMapReconciler) teardownPlan(key types.NamespacedName, running []string) []ebpfv1.EbpfNodeTeardown {
+	nodes := make(map[string]bool)
+	for _, node := range running {
+		nodes[node] = true
+	}
+	r.mutex.Lock()
+	for node, state := range r.nodes[key] {
+		if state.loaded {
+			nodes[node] = true
+		}
+	}
+	r.mutex.Unlock()
+	names := make([]string, 0, len(nodes))
+	for node := range nodes {
+		names = append(names, node)
+	}
+	sort.Strings(names)
+	plan := make([]ebpfv1.EbpfNodeTeardown, 0, len(names))
+	for _, node := range names {
+		plan = append(plan, ebpfv1.EbpfNodeTeardown{Node: node})
+	}
+	return plan
+}
+
+// teardownTimeout returns how long a deleted EbpfMap waits for its nodes
+func teardownTimeout(ebpfMap *ebpfv1.EbpfMap, logger logr.Logger) time.Duration {
+	value := strings.TrimSpace(ebpfMap.Annotations[teardownTimeoutAnnotation])
+	if value == "" {
+		return defaultTeardownTimeout
+	}
+	timeout, err := time.ParseDuration(value)
+	if err == nil && timeout < 0 {
+		err = errors.New("negative duration")
+	}
+	if err != nil {
+		logger.Error(err, "Invalid teardown timeout, using the default", "annotation", teardownTimeoutAnnotation, "value", value)
+		return defaultTeardownTimeout
+	}
+	return timeout
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	ebpfv1 "github.com/bearslyricattack/ebpf-controller/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// placeAgents returns the agents running on nodes the EbpfMap is placed on
+func (r *EbpfMapReconciler) placeAgents(ctx context.Context, ebpfMap *ebpfv1.EbpfMap, agents map[string]*nodeAgent) (map[string]*nodeAgent, error) {
+	placed := make(map[string]*nodeAgent)
+	for name, agent := range agents {
+		var node corev1.Node
+		if err := r.Get(ctx, types.NamespacedName{Name: name}, &node); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get node %s: %w", name, err)
+		}
+		ok, err := nodeMatches(&ebpfMap.Spec, &node)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			placed[name] = agent
+		}
+	}
+	return placed, nil
+}
+
+// nodeExists reports whether the named node is still part of the cluster
+func (r *EbpfMapReconciler) nodeExists(ctx context.Context, name string) bool {
+	var node corev1.Node
+	err := r.Get(ctx, types.NamespacedName{Name: name}, &node)
+	return !errors.IsNotFound(err)
+}
+
+// nodeMatches reports whether node satisfies the node selector, the required
+// node affinity and the tolerations of spec
+func nodeMatches(spec *ebpfv1.EbpfMapSpec, node *corev1.Node) (bool, error) {
+	if !labels.SelectorFromSet(spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false, nil
+	}
+	if spec.NodeAffinity != nil {
+		ok, err := affinityMatches(spec.NodeAffinity, node)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		if !tolerated(daemonSetTolerations, taint) && !tolerated(spec.Tolerations, taint) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// affinityMatches reports whether node matches any of the terms. Like pod
+// scheduling, a term without requirements matches nothing.
+func affinityMatches(affinity *corev1.NodeSelector, node *corev1.Node) (bool, error) {
+	fields := labels.Set{"metadata.name": node.Name}
+	for _, term := range affinity.NodeSelectorTerms {
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+		labelSelector, err := requirementsSelector(term.MatchExpressions)
+		if err != nil {
+			return false, fmt.Errorf("invalid nodeAffinity: %w", err)
+		}
+		fieldSelector, err := requirementsSelector(term.MatchFields)
+		if err != nil {
+			return false, fmt.Errorf("invalid nodeAffinity: %w", err)
+		}
+		if labelSelector.Matches(labels.Set(node.Labels)) && fieldSelector.Matches(fields) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// nodeSelectorOperators maps node selector operators to label selector operators
+var nodeSelectorOperators = map[corev1.NodeSelectorOperator]selection.Operator{
+	corev1.NodeSelectorOpIn:           selection.In,
+	corev1.NodeSelectorOpNotIn:        selection.NotIn,
+	corev1.NodeSelectorOpExists:       selection.Exists,
+	corev1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+	corev1.NodeSelectorOpGt:           selection.GreaterThan,
+	corev1.NodeSelectorOpLt:           selection.LessThan,
+}
+
+func requirementsSelector(requirements []corev1.NodeSelectorRequirement) (labels.Selector, error) {
+	selector := labels.NewSelector()
+	for _, req := range requirements {
+		op, ok := nodeSelectorOperators[req.Operator]
+		if !ok {
+			return nil, fmt.Errorf("unsupported operator %q", req.Operator)
+		}
+		requirement, err := labels.NewRequirement(req.Key, op, req.Values)
+		if err != nil {
+			return nil, err
+		}
+		selector = selector.Add(*requirement)
+	}
+	return selector, nil
+}
+
+// daemonSetTolerations are added to every DaemonSet pod, so the agents keep
+// running on nodes with these taints and so does the program
+var daemonSetTolerations = []corev1.Toleration{
+	{Key: corev1.TaintNodeNotReady, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+	{Key: corev1.TaintNodeUnreachable, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+	{Key: corev1.TaintNodeDiskPressure, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	{Key: corev1.TaintNodeMemoryPressure, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	{Key: corev1.TaintNodePIDPressure, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	{Key: corev1.TaintNodeUnschedulable, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	{Key: corev1.TaintNodeNetworkUnavailable, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+}
+
+func tolerated(tolerations []corev1.Toleration, taint *corev1.Taint) bool {
+	for i := range tolerations {
+		if tolerations[i].ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodePlacementChanged passes node events that can change where EbpfMaps run
+var nodePlacementChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldNode, ok := e.ObjectOld.(*corev1.Node)
+		if !ok {
+			return true
+		}
+		newNode, ok := e.ObjectNew.(*corev1.Node)
+		if !ok {
+			return true
+		}
+		return !reflect.DeepEqual(oldNode.Labels, newNode.Labels) ||
+			!reflect.DeepEqual(oldNode.Spec.Taints, newNode.Spec.Taints)
+	},
+}
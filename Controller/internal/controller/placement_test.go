@@ -0,0 +1,176 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	ebpfv1 "github.com/bearslyricattack/ebpf-controller/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testNode(name string, labels map[string]string, taints ...corev1.Taint) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Spec:       corev1.NodeSpec{Taints: taints},
+	}
+}
+
+func affinity(terms ...corev1.NodeSelectorTerm) *corev1.NodeSelector {
+	return &corev1.NodeSelector{NodeSelectorTerms: terms}
+}
+
+func expression(key string, op corev1.NodeSelectorOperator, values ...string) corev1.NodeSelectorTerm {
+	return corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{
+		{Key: key, Operator: op, Values: values},
+	}}
+}
+
+func TestAffinityMatches(t *testing.T) {
+	node := testNode("worker-1", map[string]string{"zone": "a", "cpus": "16"})
+	tests := []struct {
+		name     string
+		affinity *corev1.NodeSelector
+		want     bool
+	}{
+		{"in", affinity(expression("zone", corev1.NodeSelectorOpIn, "a", "b")), true},
+		{"in other value", affinity(expression("zone", corev1.NodeSelectorOpIn, "b")), false},
+		{"not in", affinity(expression("zone", corev1.NodeSelectorOpNotIn, "b")), true},
+		{"not in own value", affinity(expression("zone", corev1.NodeSelectorOpNotIn, "a")), false},
+		{"exists", affinity(expression("cpus", corev1.NodeSelectorOpExists)), true},
+		{"exists missing label", affinity(expression("gpu", corev1.NodeSelectorOpExists)), false},
+		{"does not exist", affinity(expression("gpu", corev1.NodeSelectorOpDoesNotExist)), true},
+		{"does not exist present label", affinity(expression("zone", corev1.NodeSelectorOpDoesNotExist)), false},
+		{"gt", affinity(expression("cpus", corev1.NodeSelectorOpGt, "8")), true},
+		{"gt equal", affinity(expression("cpus", corev1.NodeSelectorOpGt, "16")), false},
+		{"lt", affinity(expression("cpus", corev1.NodeSelectorOpLt, "32")), true},
+		{"lt smaller", affinity(expression("cpus", corev1.NodeSelectorOpLt, "4")), false},
+		{"match fields name", affinity(corev1.NodeSelectorTerm{MatchFields: []corev1.NodeSelectorRequirement{
+			{Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{"worker-1"}},
+		}}), true},
+		{"match fields other name", affinity(corev1.NodeSelectorTerm{MatchFields: []corev1.NodeSelectorRequirement{
+			{Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{"worker-2"}},
+		}}), false},
+		{"expressions and fields of one term", affinity(corev1.NodeSelectorTerm{
+			MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}},
+			MatchFields:      []corev1.NodeSelectorRequirement{{Key: "metadata.name", Operator: corev1.NodeSelectorOpNotIn, Values: []string{"worker-1"}}},
+		}), false},
+		{"any term", affinity(expression("zone", corev1.NodeSelectorOpIn, "b"), expression("cpus", corev1.NodeSelectorOpExists)), true},
+		{"empty term", affinity(corev1.NodeSelectorTerm{}), false},
+		{"no terms", affinity(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := affinityMatches(tt.affinity, node)
+			if err != nil {
+				t.Fatalf("affinityMatches: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("affinityMatches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAffinityMatchesInvalid(t *testing.T) {
+	node := testNode("worker-1", nil)
+	for _, a := range []*corev1.NodeSelector{
+		affinity(expression("zone", "Matches", "a")),
+		affinity(expression("cpus", corev1.NodeSelectorOpGt, "many")),
+		affinity(expression("zone", corev1.NodeSelectorOpIn)),
+	} {
+		if _, err := affinityMatches(a, node); err == nil {
+			t.Errorf("affinityMatches(%v) succeeded", a.NodeSelectorTerms)
+		}
+	}
+}
+
+func TestTolerated(t *testing.T) {
+	taint := &corev1.Taint{Key: "dedicated", Value: "ingress", Effect: corev1.TaintEffectNoSchedule}
+	tests := []struct {
+		name        string
+		tolerations []corev1.Toleration
+		want        bool
+	}{
+		{"none", nil, false},
+		{"equal", []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "ingress"}}, true},
+		{"other value", []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "batch"}}, false},
+		{"exists", []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}}, true},
+		{"effect", []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}}, true},
+		{"other effect", []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute}}, false},
+		{"every taint", []corev1.Toleration{{Operator: corev1.TolerationOpExists}}, true},
+		{"second toleration", []corev1.Toleration{{Key: "gpu", Operator: corev1.TolerationOpExists}, {Key: "dedicated", Operator: corev1.TolerationOpExists}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tolerated(tt.tolerations, taint); got != tt.want {
+				t.Errorf("tolerated = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeMatches(t *testing.T) {
+	dedicated := corev1.Taint{Key: "dedicated", Value: "ingress", Effect: corev1.TaintEffectNoSchedule}
+	tests := []struct {
+		name string
+		spec ebpfv1.EbpfMapSpec
+		node *corev1.Node
+		want bool
+	}{
+		{"no placement", ebpfv1.EbpfMapSpec{}, testNode("n", nil), true},
+		{"selector", ebpfv1.EbpfMapSpec{NodeSelector: map[string]string{"zone": "a"}},
+			testNode("n", map[string]string{"zone": "a", "os": "linux"}), true},
+		{"selector mismatch", ebpfv1.EbpfMapSpec{NodeSelector: map[string]string{"zone": "a"}},
+			testNode("n", map[string]string{"zone": "b"}), false},
+		{"selector and affinity", ebpfv1.EbpfMapSpec{
+			NodeSelector: map[string]string{"zone": "a"},
+			NodeAffinity: affinity(expression("gpu", corev1.NodeSelectorOpExists)),
+		}, testNode("n", map[string]string{"zone": "a"}), false},
+		{"untolerated taint", ebpfv1.EbpfMapSpec{}, testNode("n", nil, dedicated), false},
+		{"untolerated NoExecute taint", ebpfv1.EbpfMapSpec{},
+			testNode("n", nil, corev1.Taint{Key: "dedicated", Effect: corev1.TaintEffectNoExecute}), false},
+		{"tolerated taint", ebpfv1.EbpfMapSpec{Tolerations: []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}}},
+			testNode("n", nil, dedicated), true},
+		{"prefer no schedule", ebpfv1.EbpfMapSpec{},
+			testNode("n", nil, corev1.Taint{Key: "dedicated", Effect: corev1.TaintEffectPreferNoSchedule}), true},
+		{"cordoned", ebpfv1.EbpfMapSpec{},
+			testNode("n", nil, corev1.Taint{Key: corev1.TaintNodeUnschedulable, Effect: corev1.TaintEffectNoSchedule}), true},
+		{"not ready", ebpfv1.EbpfMapSpec{},
+			testNode("n", nil, corev1.Taint{Key: corev1.TaintNodeNotReady, Effect: corev1.TaintEffectNoExecute}), true},
+		{"unreachable", ebpfv1.EbpfMapSpec{},
+			testNode("n", nil, corev1.Taint{Key: corev1.TaintNodeUnreachable, Effect: corev1.TaintEffectNoExecute}), true},
+		{"memory pressure", ebpfv1.EbpfMapSpec{},
+			testNode("n", nil, corev1.Taint{Key: corev1.TaintNodeMemoryPressure, Effect: corev1.TaintEffectNoSchedule}), true},
+		{"pressure taint with another effect", ebpfv1.EbpfMapSpec{},
+			testNode("n", nil, corev1.Taint{Key: corev1.TaintNodeDiskPressure, Effect: corev1.TaintEffectNoExecute}), false},
+		{"ignored and untolerated taints", ebpfv1.EbpfMapSpec{},
+			testNode("n", nil, corev1.Taint{Key: corev1.TaintNodeNotReady, Effect: corev1.TaintEffectNoExecute}, dedicated), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nodeMatches(&tt.spec, tt.node)
+			if err != nil {
+				t.Fatalf("nodeMatches: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("nodeMatches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
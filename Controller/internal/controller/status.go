@@ -0,0 +1,186 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	ebpfv1 "github.com/bearslyricattack/ebpf-controller/api/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Phases of an EbpfMap
+const (
+	// phasePending means no node is selected yet
+	phasePending = "Pending"
+	// phaseDeploying means some selected nodes have not accepted the program yet
+	phaseDeploying = "Deploying"
+	// phaseRunning means every selected node runs the program and exports its metrics
+	phaseRunning = "Running"
+	// phaseDegraded means the program runs on some selected nodes and failed on others
+	phaseDegraded = "Degraded"
+	// phaseFailed means the program failed on every selected node
+	phaseFailed = "Failed"
+	// phaseTerminating means the EbpfMap is being torn down
+	phaseTerminating = "Terminating"
+)
+
+// nodeRetryInterval is how often nodes that failed to load or register are retried
+const nodeRetryInterval = 30 * time.Second
+
+// setNodeStatus records the state of every selected node and derives the
+// phase, conditions and summaries from it. It reports false if any node failed.
+func setNodeStatus(ebpfMap *ebpfv1.EbpfMap, states map[string]*nodeState) bool {
+	now := metav1.Now()
+	previous := make(map[string]ebpfv1.EbpfNodeStatus, len(ebpfMap.Status.Nodes))
+	for _, node := range ebpfMap.Status.Nodes {
+		previous[node.Node] = node
+	}
+	names := make([]string, 0, len(states))
+	for node := range states {
+		names = append(names, node)
+	}
+	sort.Strings(names)
+
+	nodes := make([]ebpfv1.EbpfNodeStatus, 0, len(names))
+	var loaded, registered, ready int
+	var changed bool
+	var loadErrors, registerErrors, errs []string
+	for _, name := range names {
+		state := states[name]
+		status := ebpfv1.EbpfNodeStatus{
+			Node:               name,
+			Loaded:             state.loaded,
+			Registered:         state.registered,
+			ProgramIDs:         state.programIDs,
+			LastError:          state.lastError,
+			LastTransitionTime: now,
+		}
+		// A reload shows up as new program IDs
+		if prev, ok := previous[name]; ok && prev.Loaded == status.Loaded && prev.Registered == status.Registered &&
+			slices.Equal(prev.ProgramIDs, status.ProgramIDs) {
+			status.LastTransitionTime = prev.LastTransitionTime
+		} else {
+			changed = true
+		}
+		nodes = append(nodes, status)
+
+		reason := "pending"
+		if state.lastError != "" {
+			reason = state.lastError
+			errs = append(errs, name+": "+state.lastError)
+		}
+		if state.loaded {
+			loaded++
+		} else {
+			loadErrors = append(loadErrors, name+": "+reason)
+		}
+		if state.registered {
+			registered++
+		} else {
+			registerErrors = append(registerErrors, name+": "+reason)
+		}
+		if state.loaded && state.registered {
+			ready++
+		}
+	}
+	if len(nodes) == 0 {
+		nodes = nil
+	}
+
+	phase := nodePhase(len(names), ready, len(errs))
+	// The Loaded condition still holds the generation of the previous reconcile
+	spec := meta.FindStatusCondition(ebpfMap.Status.Conditions, conditionTypeLoaded)
+	specChanged := spec == nil || spec.ObservedGeneration != ebpfMap.Generation
+	if phase == phaseRunning && (ebpfMap.Status.Phase != phaseRunning || changed || specChanged ||
+		ebpfMap.Status.LastSuccessfulUpdate.IsZero()) {
+		ebpfMap.Status.LastSuccessfulUpdate = now
+	}
+
+	ebpfMap.Status.Nodes = nodes
+	ebpfMap.Status.Phase = phase
+	ebpfMap.Status.MountStatus = summary(loaded, len(names), "Mounted", "PartiallyMounted", "NotMounted")
+	ebpfMap.Status.ForwardingStatus = summary(registered, len(names), "Forwarding", "PartiallyForwarding", "NotForwarding")
+	ebpfMap.Status.ErrorMessage = strings.Join(errs, "; ")
+	meta.SetStatusCondition(&ebpfMap.Status.Conditions, nodeCondition(ebpfMap.Generation, conditionTypeLoaded,
+		"Load", "loaded eBPF program", loaded, len(names), loadErrors))
+	meta.SetStatusCondition(&ebpfMap.Status.Conditions, nodeCondition(ebpfMap.Generation, conditionTypeRegistered,
+		"Register", "registered metrics", registered, len(names), registerErrors))
+	return len(errs) == 0
+}
+
+// nodePhase derives the phase from the number of selected, ready and failed nodes
+func nodePhase(total, ready, failed int) string {
+	switch {
+	case total == 0:
+		return phasePending
+	case ready == total:
+		return phaseRunning
+	case failed == 0:
+		return phaseDeploying
+	case ready == 0 && failed == total:
+		return phaseFailed
+	case ready > 0:
+		return phaseDegraded
+	default:
+		return phaseDeploying
+	}
+}
+
+// summary describes on how many of the selected nodes a step succeeded
+func summary(done, total int, all, some, none string) string {
+	switch {
+	case total > 0 && done == total:
+		return all
+	case done > 0:
+		return some
+	default:
+		return none
+	}
+}
+
+// nodeCondition builds a condition that is only true when the step succeeded
+// on every selected node, listing the nodes it did not succeed on
+func nodeCondition(generation int64, conditionType, step, action string, done, total int, failures []string) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               conditionType,
+		ObservedGeneration: generation,
+		Status:             metav1.ConditionFalse,
+		Message:            fmt.Sprintf("Successfully %s on %d/%d nodes", action, done, total),
+	}
+	switch {
+	case total == 0:
+		condition.Reason = "NoNodes"
+		condition.Message = "No ready node agents match the placement of the EbpfMap"
+	case done == total:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = step + "Success"
+	case done == 0:
+		condition.Reason = step + "Failed"
+	default:
+		condition.Reason = "Partial" + step
+	}
+	if len(failures) > 0 {
+		condition.Message += ", not on " + strings.Join(failures, "; ")
+	}
+	return condition
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	ebpfv1 "github.com/bearslyricattack/ebpf-controller/api/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNodePhase(t *testing.T) {
+	tests := []struct {
+		name                 string
+		total, ready, failed int
+		want                 string
+	}{
+		{"no nodes", 0, 0, 0, phasePending},
+		{"all ready", 3, 3, 0, phaseRunning},
+		{"in progress", 3, 1, 0, phaseDeploying},
+		{"nothing ready yet", 3, 0, 0, phaseDeploying},
+		{"all failed", 3, 0, 3, phaseFailed},
+		{"some failed", 3, 2, 1, phaseDegraded},
+		{"failed while others deploy", 3, 0, 1, phaseDeploying},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nodePhase(tt.total, tt.ready, tt.failed); got != tt.want {
+				t.Errorf("nodePhase(%d, %d, %d) = %s, want %s", tt.total, tt.ready, tt.failed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetNodeStatusTransitions(t *testing.T) {
+	ebpfMap := &ebpfv1.EbpfMap{ObjectMeta: metav1.ObjectMeta{Generation: 1}}
+	condition := func(conditionType string) *metav1.Condition {
+		c := meta.FindStatusCondition(ebpfMap.Status.Conditions, conditionType)
+		if c == nil {
+			t.Fatalf("condition %s is missing", conditionType)
+		}
+		return c
+	}
+
+	if !setNodeStatus(ebpfMap, nil) {
+		t.Error("no nodes reported as failing")
+	}
+	if ebpfMap.Status.Phase != phasePending || ebpfMap.Status.Nodes != nil {
+		t.Errorf("phase %s with nodes %v, want Pending without nodes", ebpfMap.Status.Phase, ebpfMap.Status.Nodes)
+	}
+	if c := condition(conditionTypeLoaded); c.Reason != "NoNodes" || c.Status != metav1.ConditionFalse {
+		t.Errorf("loaded condition without nodes: %s %s", c.Status, c.Reason)
+	}
+
+	states := map[string]*nodeState{"node-a": {}, "node-b": {}}
+	if !setNodeStatus(ebpfMap, states) {
+		t.Error("pending nodes reported as failing")
+	}
+	if ebpfMap.Status.Phase != phaseDeploying {
+		t.Errorf("phase = %s, want Deploying", ebpfMap.Status.Phase)
+	}
+	if c := condition(conditionTypeLoaded); c.Message != "Successfully loaded eBPF program on 0/2 nodes, not on node-a: pending; node-b: pending" {
+		t.Errorf("loaded condition message = %q", c.Message)
+	}
+
+	states["node-a"] = &nodeState{loaded: true, registered: true, programIDs: []uint32{10}}
+	states["node-b"] = &nodeState{lastError: "load: node-b answered 500: verifier rejected"}
+	if setNodeStatus(ebpfMap, states) {
+		t.Error("failing node not reported")
+	}
+	if ebpfMap.Status.Phase != phaseDegraded || ebpfMap.Status.MountStatus != "PartiallyMounted" {
+		t.Errorf("phase %s, mount status %s, want Degraded and PartiallyMounted", ebpfMap.Status.Phase, ebpfMap.Status.MountStatus)
+	}
+	if want := "node-b: load: node-b answered 500: verifier rejected"; ebpfMap.Status.ErrorMessage != want {
+		t.Errorf("error message = %q, want %q", ebpfMap.Status.ErrorMessage, want)
+	}
+	loaded := condition(conditionTypeLoaded)
+	if loaded.Reason != "PartialLoad" ||
+		loaded.Message != "Successfully loaded eBPF program on 1/2 nodes, not on node-b: load: node-b answered 500: verifier rejected" {
+		t.Errorf("loaded condition: %s %q", loaded.Reason, loaded.Message)
+	}
+	if registered := condition(conditionTypeRegistered); registered.Reason != "PartialRegister" {
+		t.Errorf("registered condition reason = %s", registered.Reason)
+	}
+	if !ebpfMap.Status.LastSuccessfulUpdate.IsZero() {
+		t.Error("last successful update set before the EbpfMap ran")
+	}
+
+	states["node-b"] = &nodeState{loaded: true, registered: true, programIDs: []uint32{11}}
+	if !setNodeStatus(ebpfMap, states) {
+		t.Error("running nodes reported as failing")
+	}
+	if ebpfMap.Status.Phase != phaseRunning || ebpfMap.Status.ErrorMessage != "" ||
+		ebpfMap.Status.MountStatus != "Mounted" || ebpfMap.Status.ForwardingStatus != "Forwarding" {
+		t.Errorf("status after all nodes ran: %+v", ebpfMap.Status)
+	}
+	if c := condition(conditionTypeLoaded); c.Status != metav1.ConditionTrue || c.Reason != "LoadSuccess" {
+		t.Errorf("loaded condition: %s %s", c.Status, c.Reason)
+	}
+	if ebpfMap.Status.LastSuccessfulUpdate.IsZero() {
+		t.Error("last successful update not set")
+	}
+
+	states["node-a"] = &nodeState{lastError: "load: connection refused"}
+	states["node-b"] = &nodeState{loaded: true, lastError: "register: connection refused"}
+	setNodeStatus(ebpfMap, states)
+	if ebpfMap.Status.Phase != phaseFailed {
+		t.Errorf("phase = %s, want Failed", ebpfMap.Status.Phase)
+	}
+	if c := condition(conditionTypeRegistered); c.Reason != "RegisterFailed" ||
+		c.Message != "Successfully registered metrics on 0/2 nodes, not on node-a: load: connection refused; node-b: register: connection refused" {
+		t.Errorf("registered condition: %s %q", c.Reason, c.Message)
+	}
+}
+
+func TestSetNodeStatusTransitionTime(t *testing.T) {
+	earlier := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	ebpfMap := &ebpfv1.EbpfMap{Status: ebpfv1.EbpfMapStatus{Nodes: []ebpfv1.EbpfNodeStatus{
+		{Node: "node-a", Loaded: true, Registered: true, ProgramIDs: []uint32{10}, LastTransitionTime: earlier},
+		{Node: "node-b", Loaded: true, Registered: true, ProgramIDs: []uint32{20}, LastTransitionTime: earlier},
+		{Node: "node-c", Loaded: true, LastTransitionTime: earlier},
+	}}}
+	states := map[string]*nodeState{
+		// Unchanged apart from the error
+		"node-a": {loaded: true, registered: true, programIDs: []uint32{10}, lastError: "register: timeout"},
+		// Reloaded
+		"node-b": {loaded: true, registered: true, programIDs: []uint32{21}},
+		// Registered
+		"node-c": {loaded: true, registered: true},
+		// New
+		"node-d": {},
+	}
+	setNodeStatus(ebpfMap, states)
+	want := map[string]bool{"node-a": true, "node-b": false, "node-c": false, "node-d": false}
+	for _, node := range ebpfMap.Status.Nodes {
+		if kept := node.LastTransitionTime.Equal(&earlier); kept != want[node.Node] {
+			t.Errorf("%s: transition time kept = %v, want %v", node.Node, kept, want[node.Node])
+		}
+	}
+	if ebpfMap.Status.Nodes[0].LastError != "register: timeout" {
+		t.Errorf("last error of node-a = %q", ebpfMap.Status.Nodes[0].LastError)
+	}
+}
+
+func TestSetNodeStatusLastSuccessfulUpdate(t *testing.T) {
+	earlier := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	states := map[string]*nodeState{"node-a": {loaded: true, registered: true, programIDs: []uint32{10}}}
+	ebpfMap := &ebpfv1.EbpfMap{ObjectMeta: metav1.ObjectMeta{Generation: 1}}
+	setNodeStatus(ebpfMap, states)
+	ebpfMap.Status.LastSuccessfulUpdate = earlier
+
+	// Nothing changed
+	setNodeStatus(ebpfMap, states)
+	if !ebpfMap.Status.LastSuccessfulUpdate.Equal(&earlier) {
+		t.Error("last successful update moved without a change")
+	}
+	// A new generation that runs everywhere
+	ebpfMap.Generation = 2
+	setNodeStatus(ebpfMap, states)
+	if ebpfMap.Status.LastSuccessfulUpdate.Equal(&earlier) {
+		t.Error("last successful update kept after a new generation ran")
+	}
+}
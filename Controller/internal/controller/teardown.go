@@ -0,0 +1,110 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// teardownNodes unregisters the metrics and unloads the program on the given
+// nodes concurrently and returns the errors of the nodes that failed
+func (r *EbpfMapReconciler) teardownNodes(ctx context.Context, name string, agents []*nodeAgent, logger logr.Logger) map[string]error {
+	failed := make(map[string]error)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, agent := range agents {
+		wg.Add(1)
+		go func(agent *nodeAgent) {
+			defer wg.Done()
+			nodeLogger := logger.WithValues("node", agent.Node)
+			if err := teardownNode(ctx, name, agent); err != nil {
+				nodeLogger.Error(err, "Teardown failed")
+				mu.Lock()
+				failed[agent.Node] = err
+				mu.Unlock()
+				return
+			}
+			nodeLogger.Info("Teardown successful")
+		}(agent)
+	}
+	wg.Wait()
+	return failed
+}
+
+// teardownNode unregisters the metrics and then unloads the program on one
+// node. A program the Loader no longer knows counts as unloaded.
+func teardownNode(ctx context.Context, name string, agent *nodeAgent) error {
+	payload, err := json.Marshal(map[string]string{"name": name})
+	if err != nil {
+		return err
+	}
+	if err := callAgent(ctx, http.MethodDelete, agent.UnregisterURL, payload); err != nil {
+		return fmt.Errorf("failed to unregister metrics: %w", err)
+	}
+	if err := callAgent(ctx, http.MethodGet, agent.UnloadURL+"?name="+url.QueryEscape(name), nil, http.StatusNotFound); err != nil {
+		return fmt.Errorf("failed to unload program: %w", err)
+	}
+	return nil
+}
+
+// callAgent sends a request to a node agent and fails unless it answers 200
+// or one of the accepted status codes
+func callAgent(ctx context.Context, method string, agentURL string, payload []byte, accepted ...int) error {
+	req, err := http.NewRequestWithContext(ctx, method, agentURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusOK || slices.Contains(accepted, resp.StatusCode) {
+		return nil
+	}
+	return responseError(agentURL, resp.StatusCode, body)
+}
+
+// responseError describes a failed agent response, preferring the "error"
+// field the Loader answers with over the raw body
+func responseError(agentURL string, status int, body []byte) error {
+	message := strings.TrimSpace(string(body))
+	var reply struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &reply) == nil && reply.Error != "" {
+		message = reply.Error
+	}
+	return fmt.Errorf("%s answered %d: %s", extractHostFromURL(agentURL), status, message)
+}
@@ -1,15 +1,20 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/bearslyricattack/EBPForge/internal/loader"
+	"github.com/bearslyricattack/EBPForge/internal/registry"
 	"github.com/bearslyricattack/EBPForge/pkg"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/bearslyricattack/EBPForge/internal/compiler"
-	"github.com/cilium/ebpf"
-	"github.com/cilium/ebpf/link"
 	"github.com/gin-gonic/gin"
 )
 
@@ -29,52 +34,157 @@ const (
 // AttachType defines the type of eBPF program attachment
 type AttachType string
 
-var (
-	kprobeLink link.Link
-	collection *ebpf.Collection
-)
+// loadMutex serializes load and unload so concurrent requests for one name cannot interleave
+var loadMutex sync.Mutex
+
+// createProgramHandler loads a program described by a JSON pkg.LoadRequest body
+func createProgramHandler(c *gin.Context) {
+	var req pkg.LoadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"error": fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+	status, body := loadProgram(req.AttachArgs, req.Options)
+	c.JSON(status, body)
+}
 
+// loadHandler is the query string variant of createProgramHandler.
+// Deprecated: source code in the URL hits length limits and ends up in access logs, use POST /v1/programs.
 func loadHandler(c *gin.Context) {
-	name := c.Query("name")
-	target := c.Query("target")
-	ebpftype := c.Query("type")
-	code := c.Query("code")
-	program := c.Query("program")
-	fmt.Println("name:", name, "target:", target, "type:", ebpftype, "code:", code, "program:", program)
+	var args pkg.AttachArgs
+	args.Name = c.Query("name")
+	args.Target = c.Query("target")
+	args.Ebpftype = c.Query("type")
+	args.Code = c.Query("code")
+	args.Program = c.Query("program")
+	fmt.Println("Deprecated GET /load called for", args.Name, "- use POST /v1/programs")
+	c.Header("Deprecation", "true")
+	c.Header("Link", "</v1/programs>; rel=\"successor-version\"")
+	status, body := loadProgram(args, pkg.LoadOptions{Replace: true})
+	c.JSON(status, body)
+}
+
+// loadProgram compiles, attaches and registers a program, returning the HTTP status and response body
+func loadProgram(args pkg.AttachArgs, opts pkg.LoadOptions) (int, gin.H) {
+	fmt.Println("name:", args.Name, "target:", args.Target, "type:", args.Ebpftype, "program:", args.Program, "code bytes:", len(args.Code))
+	if !validProgramName(args.Name) {
+		return 400, gin.H{
+			"error": fmt.Sprintf("Invalid program name: %q", args.Name),
+		}
+	}
+	if args.Code == "" {
+		return 400, gin.H{
+			"error": "Program code must be provided",
+		}
+	}
+	loadMutex.Lock()
+	defer loadMutex.Unlock()
+	previous, exists := registry.Get(args.Name)
+	if exists && !opts.Replace {
+		return 409, gin.H{
+			"error": fmt.Sprintf("Program %s is already loaded, set options.replace to reload it", args.Name),
+		}
+	}
 	// Compile
-	path, err := compiler.CompileFromCode(code, name)
-	fmt.Println("Compilation successful! Current file location is path:", path)
+	path, err := compiler.CompileFromCode(args.Code, args.Name)
 	if err != nil {
-		c.JSON(500, gin.H{
+		return 500, gin.H{
 			"error": fmt.Sprintf("Compilation failed: %v", err),
-		})
-		return
+		}
 	}
-	// Attach
-	var args pkg.AttachArgs
-	args.Name = name
-	args.Target = target
-	args.Ebpftype = ebpftype
-	args.Code = code
-	args.Program = program
-	_, collection, err = loader.LoadAndAttachBPF(path, args)
+	fmt.Println("Compilation successful! Current file location is path:", path)
+	args, err = loader.ResolveAttachArgs(path, args)
 	if err != nil {
-		c.JSON(500, gin.H{
-			"error": fmt.Sprintf("Failed to load eBPF program, program type %s: %v", ebpftype, err),
+		return 400, gin.H{
+			"error": fmt.Sprintf("Invalid attach arguments: %v", err),
+		}
+	}
+	// Attach, the previous instance is only torn down once the new one is attached
+	links, coll, err := loader.Replace(previous, path, args)
+	if err != nil {
+		return 500, gin.H{
+			"error": fmt.Sprintf("Failed to load eBPF program: %v", err),
+		}
+	}
+	// The new instance is in place, so the previous one is released even if parts of it are left over
+	var releaseErr error
+	if previous != nil {
+		_, releaseErr = previous.Teardown()
+	}
+	// Restores reload from a copy, the compile output is overwritten by the next load of the program
+	objectPath, err := registry.SaveObject(args.Name, path)
+	if err != nil {
+		fmt.Printf("Failed to save object of %s, a restart may reload a later compile: %v\n", args.Name, err)
+		objectPath = path
+	}
+	pinDir := loader.PinDir(args.Name)
+	mapPaths := make(map[string]string, len(coll.Maps))
+	for mapName := range coll.Maps {
+		mapPaths[mapName] = filepath.Join(pinDir, mapName)
+	}
+	attachments := make([]*registry.Attachment, 0, len(args.Attachments))
+	for i, a := range args.Attachments {
+		linkPinPath := loader.LinkPinPath(args.Name, i, a.Program)
+		if _, err := os.Stat(linkPinPath); err != nil {
+			linkPinPath = ""
+		}
+		attachments = append(attachments, &registry.Attachment{
+			Attachment:     a,
+			ProgramPinPath: loader.ProgramPinPath(args.Name, a.Program),
+			LinkPinPath:    linkPinPath,
+			Link:           links[i],
 		})
-		return
 	}
-	c.JSON(200, gin.H{
+	program := &registry.Program{
+		Name:        args.Name,
+		ObjectPath:  objectPath,
+		SourceHash:  sourceHash(args.Code),
+		PinDir:      pinDir,
+		MapPaths:    mapPaths,
+		Attachments: attachments,
+		LoadedAt:    time.Now(),
+		Collection:  coll,
+	}
+	registry.Add(program)
+	if err := registry.SaveManifest(program); err != nil {
+		fmt.Printf("Failed to save manifest of %s, it will not survive a restart: %v\n", args.Name, err)
+	}
+	body := gin.H{
 		"status":  "success",
 		"message": fmt.Sprintf("Program loaded and attached to %s", path),
-	})
+		"program": program.Status(),
+	}
+	if releaseErr != nil {
+		body["warning"] = fmt.Sprintf("Previous instance was not fully released: %v", releaseErr)
+	}
+	return 200, body
 }
 
 // Query the status of all loaded eBPF programs
 func loadStatusHandler(c *gin.Context) {
-	// Call bpf tool and return
-	// Return all loaded programs
-	//c.JSON(200, )
+	name := c.Param("name")
+	if name != "" {
+		program, ok := registry.Get(name)
+		if !ok {
+			c.JSON(404, gin.H{
+				"error": fmt.Sprintf("Program %s is not loaded", name),
+			})
+			return
+		}
+		c.JSON(200, program.Status())
+		return
+	}
+	programs := registry.List()
+	statuses := make([]registry.ProgramStatus, 0, len(programs))
+	for _, program := range programs {
+		statuses = append(statuses, program.Status())
+	}
+	c.JSON(200, gin.H{
+		"count":    len(statuses),
+		"programs": statuses,
+	})
 }
 
 // Unload eBPF program
@@ -86,27 +196,66 @@ func unloadHandler(c *gin.Context) {
 		})
 		return
 	}
-	// Call bpf tool and return
+	loadMutex.Lock()
+	defer loadMutex.Unlock()
+	program, ok := registry.Get(name)
+	if !ok {
+		c.JSON(404, gin.H{
+			"error": fmt.Sprintf("Program %s is not loaded", name),
+		})
+		return
+	}
+	result, err := program.Teardown()
+	if err != nil {
+		// Still registered so the unload can be retried
+		c.JSON(500, gin.H{
+			"error":    fmt.Sprintf("Failed to unload program %s: %v", name, err),
+			"released": result,
+		})
+		return
+	}
+	registry.Remove(name)
 	c.JSON(200, gin.H{
-		"status":  "success",
-		"message": fmt.Sprintf("Program %s has been successfully unloaded", name),
+		"status":   "success",
+		"message":  fmt.Sprintf("Program %s has been successfully unloaded", name),
+		"released": result,
 	})
 }
 
+// sourceHash returns the hex encoded SHA-256 of the program source
+func sourceHash(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// validProgramName reports whether name is safe to use as a pin directory name.
+// Hidden names are reserved for the Loader's own directories.
+func validProgramName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && filepath.Base(name) == name
+}
+
 func main() {
 	port := ":8082"
 	if envPort := os.Getenv("PORT"); envPort != "" {
 		port = ":" + envPort
 	}
+	if stateDir := os.Getenv("STATE_DIR"); stateDir != "" {
+		registry.StateDir = stateDir
+	}
+	if err := loader.Restore(); err != nil {
+		log.Printf("Failed to restore programs from %s: %v", registry.StateDir, err)
+	}
 	r := gin.Default()
+	r.POST("/v1/programs", createProgramHandler)
 	r.GET("/load", loadHandler)
+	r.GET("/unload", unloadHandler)
+	r.GET("/status", loadStatusHandler)
+	r.GET("/status/:name", loadStatusHandler)
 	fmt.Printf("HTTP server starting, listening on port %s\n", port)
+	// Pinned links stay attached after their file descriptors are closed
 	defer func() {
-		if kprobeLink != nil {
-			kprobeLink.Close()
-		}
-		if collection != nil {
-			collection.Close()
+		for _, program := range registry.List() {
+			program.Close()
 		}
 	}()
 	if err := r.Run(port); err != nil {
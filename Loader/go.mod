@@ -5,6 +5,8 @@ go 1.23.6
 require (
 	github.com/cilium/ebpf v0.17.3
 	github.com/gin-gonic/gin v1.10.0
+	github.com/vishvananda/netlink v1.3.0
+	golang.org/x/sys v0.30.0
 )
 
 require (
@@ -28,10 +30,10 @@ require (
 	github.com/stretchr/testify v1.10.0 // indirect
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	github.com/ugorji/go/codec v1.2.12 // indirect
+	github.com/vishvananda/netns v0.0.4 // indirect
 	golang.org/x/arch v0.8.0 // indirect
 	golang.org/x/crypto v0.31.0 // indirect
 	golang.org/x/net v0.33.0 // indirect
-	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
 	google.golang.org/protobuf v1.36.5 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
@@ -0,0 +1,182 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bearslyricattack/EBPForge/pkg"
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// cgroupRoot is the cgroup v2 mount point on the host
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupAttachTypes maps the cgroup sub-types accepted in AttachArgs.CgroupAttach to kernel attach types
+var cgroupAttachTypes = map[string]ebpf.AttachType{
+	"ingress":      ebpf.AttachCGroupInetIngress,
+	"egress":       ebpf.AttachCGroupInetEgress,
+	"sock_create":  ebpf.AttachCGroupInetSockCreate,
+	"sock_release": ebpf.AttachCgroupInetSockRelease,
+	"sock_ops":     ebpf.AttachCGroupSockOps,
+	"device":       ebpf.AttachCGroupDevice,
+	"bind4":        ebpf.AttachCGroupInet4Bind,
+	"bind6":        ebpf.AttachCGroupInet6Bind,
+	"post_bind4":   ebpf.AttachCGroupInet4PostBind,
+	"post_bind6":   ebpf.AttachCGroupInet6PostBind,
+	"connect4":     ebpf.AttachCGroupInet4Connect,
+	"connect6":     ebpf.AttachCGroupInet6Connect,
+	"sendmsg4":     ebpf.AttachCGroupUDP4Sendmsg,
+	"sendmsg6":     ebpf.AttachCGroupUDP6Sendmsg,
+	"recvmsg4":     ebpf.AttachCGroupUDP4Recvmsg,
+	"recvmsg6":     ebpf.AttachCGroupUDP6Recvmsg,
+	"sysctl":       ebpf.AttachCGroupSysctl,
+	"getsockopt":   ebpf.AttachCGroupGetsockopt,
+	"setsockopt":   ebpf.AttachCGroupSetsockopt,
+}
+
+// cgroupSectionAttach maps ELF section names to cgroup sub-types.
+// cgroup/skb is missing on purpose: it does not say whether the program
+// filters ingress or egress, so the sub-type has to be given explicitly.
+var cgroupSectionAttach = map[string]string{
+	"cgroup_skb/ingress":  "ingress",
+	"cgroup_skb/egress":   "egress",
+	"cgroup/sock":         "sock_create",
+	"cgroup/sock_create":  "sock_create",
+	"cgroup/sock_release": "sock_release",
+	"sockops":             "sock_ops",
+	"cgroup/dev":          "device",
+	"cgroup/bind4":        "bind4",
+	"cgroup/bind6":        "bind6",
+	"cgroup/post_bind4":   "post_bind4",
+	"cgroup/post_bind6":   "post_bind6",
+	"cgroup/connect4":     "connect4",
+	"cgroup/connect6":     "connect6",
+	"cgroup/sendmsg4":     "sendmsg4",
+	"cgroup/sendmsg6":     "sendmsg6",
+	"cgroup/recvmsg4":     "recvmsg4",
+	"cgroup/recvmsg6":     "recvmsg6",
+	"cgroup/sysctl":       "sysctl",
+	"cgroup/getsockopt":   "getsockopt",
+	"cgroup/setsockopt":   "setsockopt",
+}
+
+// attachCgroup attaches prog to a cgroup. The target is a cgroup v2 path,
+// "pod:<uid>" for a pod's cgroup or "container:<id>" for a container's cgroup.
+func attachCgroup(prog *ebpf.Program, args pkg.Attachment) (pkg.Link, error) {
+	subType := args.CgroupAttach
+	if subType == "" && args.Ebpftype == AttachCgroupSock {
+		subType = "sock_create"
+	}
+	attach, ok := cgroupAttachTypes[subType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported cgroup attach type %q, supported: %v", subType, cgroupAttachNames())
+	}
+	path, err := resolveCgroupPath(args.Target)
+	if err != nil {
+		return nil, err
+	}
+	return link.AttachCgroup(link.CgroupOptions{
+		Path:    path,
+		Attach:  attach,
+		Program: prog,
+	})
+}
+
+// resolveCgroupPath turns a cgroup target into a cgroup v2 directory
+func resolveCgroupPath(target string) (string, error) {
+	if w, ok := parseWorkload(target); ok {
+		return findCgroup(w.matches, w.what)
+	}
+	if !filepath.IsAbs(target) {
+		return "", errors.New("cgroup target should be an absolute cgroup path, 'pod:<uid>' or 'container:<id>'")
+	}
+	return target, nil
+}
+
+// workload is a pod or container whose cgroups are found by name
+type workload struct {
+	what string   // Description for error messages
+	ids  []string // Every cgroup of the workload has one of these in its name
+}
+
+// podWorkload matches the cgroups of the pod with the given UID.
+// The systemd cgroup driver writes pod UIDs with underscores.
+func podWorkload(uid string) workload {
+	return workload{
+		what: "pod " + uid,
+		ids:  []string{"pod" + uid, "pod" + strings.ReplaceAll(uid, "-", "_")},
+	}
+}
+
+// containerWorkload matches the cgroups of the container with the given ID.
+// IDs are accepted as reported in pod status, e.g. "containerd://<id>".
+func containerWorkload(id string) workload {
+	if _, trimmed, found := strings.Cut(id, "://"); found {
+		id = trimmed
+	}
+	return workload{what: "container " + id, ids: []string{id}}
+}
+
+// parseWorkload parses a "pod:<uid>" or "container:<id>" target.
+// An empty UID or ID is not a workload, it would match every cgroup.
+func parseWorkload(target string) (workload, bool) {
+	if uid, ok := strings.CutPrefix(target, "pod:"); ok && uid != "" {
+		return podWorkload(uid), true
+	}
+	if id, ok := strings.CutPrefix(target, "container:"); ok {
+		w := containerWorkload(id)
+		return w, w.ids[0] != ""
+	}
+	return workload{}, false
+}
+
+// matches reports whether a cgroup name or path belongs to the workload
+func (w workload) matches(cgroup string) bool {
+	for _, id := range w.ids {
+		if strings.Contains(cgroup, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// findCgroup returns the first cgroup directory whose name matches.
+// Parents are visited before children, so a pod matches before its containers.
+func findCgroup(match func(string) bool, what string) (string, error) {
+	var found string
+	err := filepath.WalkDir(cgroupRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Cgroups come and go while walking
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if match(d.Name()) {
+			found = path
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to walk %s: %w", cgroupRoot, err)
+	}
+	if found == "" {
+		return "", fmt.Errorf("no cgroup found for %s under %s", what, cgroupRoot)
+	}
+	return found, nil
+}
+
+func cgroupAttachNames() []string {
+	names := make([]string, 0, len(cgroupAttachTypes))
+	for name := range cgroupAttachTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
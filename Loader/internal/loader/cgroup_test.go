@@ -0,0 +1,79 @@
+package loader
+
+import "testing"
+
+func TestWorkloadMatches(t *testing.T) {
+	const (
+		podUID      = "8f4c2a9e-5b1d-4c3e-9a7f-2d6b8e1c0f34"
+		containerID = "3b6f1e0c9d2a47b58e1f6c3d2a9b0e7f4c1d8a5b6e3f2c9d0a7b4e1f8c5d2a6b"
+	)
+	tests := []struct {
+		name   string
+		target string
+		cgroup string
+		want   bool
+	}{
+		{"pod systemd", "pod:" + podUID,
+			"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod8f4c2a9e_5b1d_4c3e_9a7f_2d6b8e1c0f34.slice", true},
+		{"pod systemd directory name", "pod:" + podUID,
+			"kubepods-besteffort-pod8f4c2a9e_5b1d_4c3e_9a7f_2d6b8e1c0f34.slice", true},
+		{"pod cgroupfs", "pod:" + podUID,
+			"/kubepods/burstable/pod8f4c2a9e-5b1d-4c3e-9a7f-2d6b8e1c0f34", true},
+		{"container of pod cgroupfs", "pod:" + podUID,
+			"/kubepods/pod8f4c2a9e-5b1d-4c3e-9a7f-2d6b8e1c0f34/" + containerID, true},
+		{"proc cgroup line", "pod:" + podUID,
+			"0::/kubepods.slice/kubepods-pod8f4c2a9e_5b1d_4c3e_9a7f_2d6b8e1c0f34.slice/cri-containerd-" + containerID + ".scope", true},
+		{"other pod", "pod:" + podUID,
+			"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1a2b3c4d_0000_4c3e_9a7f_2d6b8e1c0f34.slice", false},
+		{"pods parent", "pod:" + podUID, "/kubepods.slice/kubepods-burstable.slice", false},
+		{"container systemd", "container:" + containerID,
+			"/kubepods.slice/kubepods-pod8f4c2a9e_5b1d_4c3e_9a7f_2d6b8e1c0f34.slice/cri-containerd-" + containerID + ".scope", true},
+		{"container cgroupfs", "container:" + containerID,
+			"/kubepods/besteffort/pod8f4c2a9e-5b1d-4c3e-9a7f-2d6b8e1c0f34/" + containerID, true},
+		{"container id from pod status", "container:containerd://" + containerID,
+			"cri-containerd-" + containerID + ".scope", true},
+		{"docker container id from pod status", "container:docker://" + containerID,
+			"/kubepods/burstable/pod8f4c2a9e-5b1d-4c3e-9a7f-2d6b8e1c0f34/docker-" + containerID + ".scope", true},
+		{"sibling container", "container:" + containerID,
+			"/kubepods.slice/kubepods-pod8f4c2a9e_5b1d_4c3e_9a7f_2d6b8e1c0f34.slice/cri-containerd-0c9d2a47b58e1f6c3d2a9b0e7f4c1d8a5b6e3f2c9d0a7b4e1f8c5d2a6b3b6f1e.scope", false},
+		{"pod cgroup for a container", "container:" + containerID,
+			"/kubepods.slice/kubepods-pod8f4c2a9e_5b1d_4c3e_9a7f_2d6b8e1c0f34.slice", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, ok := parseWorkload(tt.target)
+			if !ok {
+				t.Fatalf("parseWorkload(%q) is not a workload", tt.target)
+			}
+			if got := w.matches(tt.cgroup); got != tt.want {
+				t.Errorf("%s matches %q = %v, want %v", w.what, tt.cgroup, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWorkload(t *testing.T) {
+	tests := []struct {
+		target string
+		what   string
+		ok     bool
+	}{
+		{"pod:8f4c2a9e-5b1d", "pod 8f4c2a9e-5b1d", true},
+		{"container:3b6f1e0c", "container 3b6f1e0c", true},
+		{"container:containerd://3b6f1e0c", "container 3b6f1e0c", true},
+		{"container:cri-o://3b6f1e0c", "container 3b6f1e0c", true},
+		{"pod:", "", false},
+		{"container:", "", false},
+		{"container:containerd://", "", false},
+		{"/sys/fs/cgroup/system.slice", "", false},
+		{"pid:42", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			w, ok := parseWorkload(tt.target)
+			if ok != tt.ok || (ok && w.what != tt.what) {
+				t.Errorf("parseWorkload(%q) = %q, %v, want %q, %v", tt.target, w.what, ok, tt.what, tt.ok)
+			}
+		})
+	}
+}
@@ -24,11 +24,33 @@ const (
 	AttachTC         string = "tc"
 	AttachSockFilter string = "sockfilter"
 	AttachCgroupSock string = "cgroup_sock"
+	AttachCgroup     string = "cgroup"
 	AttachLSM        string = "lsm"
+
+	AttachFentry        string = "fentry"
+	AttachFexit         string = "fexit"
+	AttachFmodRet       string = "fmod_ret"
+	AttachRawTracepoint string = "raw_tracepoint"
+	AttachTpBTF         string = "tp_btf"
 )
 
-// LoadAndAttachBPF loads an eBPF object file and attaches it according to the specified arguments
-func LoadAndAttachBPF(bpfObjectPath string, args pkg.AttachArgs) (link.Link, *ebpf.Collection, error) {
+// BPFFSPath is the mount point of the BPF filesystem used for pinning
+const BPFFSPath = "/sys/fs/bpf"
+
+// PinDir returns the directory where objects of the named program are pinned
+func PinDir(name string) string {
+	return filepath.Join(BPFFSPath, name)
+}
+
+// LoadAndAttachBPF loads an eBPF object file and attaches every program listed in args.
+// The returned links are in the order of args.AttachmentList(). Attaching is all or
+// nothing: if any program fails to attach or pin, everything attached so far is rolled back.
+func LoadAndAttachBPF(bpfObjectPath string, args pkg.AttachArgs) ([]pkg.Link, *ebpf.Collection, error) {
+	return loadAndAttach(bpfObjectPath, args, PinDir(args.Name))
+}
+
+// loadAndAttach is LoadAndAttachBPF pinning everything under progDir
+func loadAndAttach(bpfObjectPath string, args pkg.AttachArgs, progDir string) ([]pkg.Link, *ebpf.Collection, error) {
 	if err := rlimit.RemoveMemlock(); err != nil {
 		return nil, nil, fmt.Errorf("failed to remove MEMLOCK limit: %w", err)
 	}
@@ -38,97 +60,194 @@ func LoadAndAttachBPF(bpfObjectPath string, args pkg.AttachArgs) (link.Link, *eb
 		return nil, nil, fmt.Errorf("failed to load eBPF object file: %w", err)
 	}
 
+	attachments := args.AttachmentList()
+	for _, a := range attachments {
+		if a.Ebpftype != AttachLSM {
+			continue
+		}
+		progSpec, ok := spec.Programs[a.Program]
+		if !ok {
+			return nil, nil, fmt.Errorf("program '%s' not found in object file", a.Program)
+		}
+		if err := validateLSMSpec(progSpec, a); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	coll, err := ebpf.NewCollection(spec)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create eBPF collection: %w", err)
 	}
 
-	prog, ok := coll.Programs[args.Program]
-	if !ok {
-		availableProgs := make([]string, 0, len(coll.Programs))
-		for name := range coll.Programs {
-			availableProgs = append(availableProgs, name)
+	links := make([]pkg.Link, 0, len(attachments))
+	rollback := func() {
+		for _, lnk := range links {
+			lnk.Close()
 		}
 		coll.Close()
-		return nil, nil, fmt.Errorf("program '%s' not found, available: %v", args.Name, availableProgs)
 	}
-
-	var lnk link.Link
-
-	switch args.Ebpftype {
-	case AttachKprobe:
-		fmt.Println(1211111)
-		lnk, err = link.Kprobe(args.Target, prog, nil)
-	case AttachKretprobe:
-		lnk, err = link.Kretprobe(args.Target, prog, nil)
-	case AttachTracepoint:
-		ss, ev, ok := strings.Cut(args.Target, ":")
+	for _, a := range attachments {
+		prog, ok := coll.Programs[a.Program]
 		if !ok {
-			coll.Close()
-			return nil, nil, errors.New("tracepoint target format should be 'subsys:event'")
+			availableProgs := make([]string, 0, len(coll.Programs))
+			for name := range coll.Programs {
+				availableProgs = append(availableProgs, name)
+			}
+			rollback()
+			return nil, nil, fmt.Errorf("program '%s' not found, available: %v", a.Program, availableProgs)
 		}
-		lnk, err = link.Tracepoint(ss, ev, prog, nil)
-	case AttachXDP:
-		iface, err2 := netInterfaceByName(args.Target)
-		if err2 != nil {
-			coll.Close()
-			return nil, nil, fmt.Errorf("failed to get network interface: %w", err2)
+		lnk, err := Attach(prog, args.Name, a)
+		if err != nil {
+			rollback()
+			return nil, nil, fmt.Errorf("attachment of '%s' (%s on %s) failed: %w", a.Program, a.Ebpftype, a.Target, err)
 		}
-		lnk, err = link.AttachXDP(link.XDPOptions{
-			Program:   prog,
-			Interface: iface.Index,
-		})
-	case AttachSockFilter:
-		coll.Close()
-		return nil, nil, errors.New("SockFilter type requires a socket fd, skipped here")
-	case AttachCgroupSock:
-		lnk, err = link.AttachCgroup(link.CgroupOptions{
-			Path:    args.Target,
-			Attach:  ebpf.AttachCGroupInetSockCreate,
-			Program: prog,
-		})
-	default:
-		coll.Close()
-		return nil, nil, fmt.Errorf("unsupported attach type: %s", args.Ebpftype)
+		links = append(links, lnk)
 	}
 
-	if err != nil {
-		coll.Close()
-		return nil, nil, fmt.Errorf("attachment failed: %w", err)
-	}
-
-	bpfFSPath := "/sys/fs/bpf"
-	if err := os.MkdirAll(bpfFSPath, 0755); err != nil {
-		lnk.Close()
-		coll.Close()
+	if err := os.MkdirAll(BPFFSPath, 0755); err != nil {
+		rollback()
 		return nil, nil, fmt.Errorf("failed to create BPF filesystem path: %w", err)
 	}
 
-	progDir := filepath.Join(bpfFSPath, args.Name)
 	if err := os.MkdirAll(progDir, 0755); err != nil {
-		lnk.Close()
-		coll.Close()
+		rollback()
 		return nil, nil, fmt.Errorf("failed to create program directory: %w", err)
 	}
+	// Pins keep links attached, so a failure from here on also removes them
+	rollbackPins := func() {
+		rollback()
+		os.RemoveAll(progDir)
+	}
 
 	for mapName, m := range coll.Maps {
 		mapPath := filepath.Join(progDir, mapName)
 		if _, err := os.Stat(mapPath); err == nil {
 			if err := os.Remove(mapPath); err != nil {
-				lnk.Close()
-				coll.Close()
+				rollbackPins()
 				return nil, nil, fmt.Errorf("failed to remove existing map '%s': %w", mapName, err)
 			}
 		}
 
 		if err := m.Pin(mapPath); err != nil {
-			lnk.Close()
-			coll.Close()
+			rollbackPins()
 			return nil, nil, fmt.Errorf("failed to pin map '%s': %w", mapName, err)
 		}
 		fmt.Printf("Map '%s' pinned to: %s\n", mapName, mapPath)
 	}
-	return lnk, coll, nil
+
+	for i, a := range attachments {
+		if err := pinProgramAndLink(progDir, i, a, coll.Programs[a.Program], links[i]); err != nil {
+			rollbackPins()
+			return nil, nil, err
+		}
+	}
+	return links, coll, nil
+}
+
+// Attach attaches a loaded program of the named object according to the attach type and target
+func Attach(prog *ebpf.Program, name string, args pkg.Attachment) (pkg.Link, error) {
+	switch args.Ebpftype {
+	case AttachKprobe:
+		return link.Kprobe(args.Target, prog, nil)
+	case AttachKretprobe:
+		return link.Kretprobe(args.Target, prog, nil)
+	case AttachUprobe:
+		return attachUprobe(prog, args, false)
+	case AttachUretprobe:
+		return attachUprobe(prog, args, true)
+	case AttachTracepoint:
+		ss, ev, ok := strings.Cut(args.Target, ":")
+		if !ok {
+			return nil, errors.New("tracepoint target format should be 'subsys:event'")
+		}
+		return link.Tracepoint(ss, ev, prog, nil)
+	case AttachXDP:
+		iface, err := netInterfaceByName(args.Target)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get network interface: %w", err)
+		}
+		return link.AttachXDP(link.XDPOptions{
+			Program:   prog,
+			Interface: iface.Index,
+		})
+	case AttachTC:
+		return attachTC(prog, name, args)
+	case AttachLSM:
+		return attachLSM(prog)
+	case AttachFentry, AttachFexit, AttachFmodRet, AttachTpBTF:
+		// The BTF attach point was resolved from the section name at load time
+		return link.AttachTracing(link.TracingOptions{Program: prog})
+	case AttachRawTracepoint:
+		if args.Target == "" {
+			return nil, errors.New("raw_tracepoint target must name the tracepoint, e.g. 'sched_switch'")
+		}
+		return link.AttachRawTracepoint(link.RawTracepointOptions{
+			Name:    args.Target,
+			Program: prog,
+		})
+	case AttachSockFilter:
+		return attachSockFilter(prog, args)
+	case AttachCgroupSock, AttachCgroup:
+		return attachCgroup(prog, args)
+	default:
+		return nil, fmt.Errorf("unsupported attach type: %s", args.Ebpftype)
+	}
+}
+
+// ProgramPinPath returns where a program of the named object is pinned
+func ProgramPinPath(name string, program string) string {
+	return programPinPath(PinDir(name), program)
+}
+
+func programPinPath(progDir string, program string) string {
+	return filepath.Join(progDir, "programs", program)
+}
+
+// LinkPinPath returns where the link of the index-th attachment of the named object is pinned.
+// The index keeps links apart when one program is attached to several targets.
+func LinkPinPath(name string, index int, program string) string {
+	return linkPinPath(PinDir(name), index, program)
+}
+
+func linkPinPath(progDir string, index int, program string) string {
+	return filepath.Join(progDir, "links", fmt.Sprintf("%d_%s", index, program))
+}
+
+// pinProgramAndLink pins the program and its link so they outlive the Loader process.
+// Links that cannot be pinned (perf event based kprobes, legacy cgroup attachments,
+// netlink tc filters, socket filters) are left unpinned and are re-attached from the
+// pinned program on restore.
+func pinProgramAndLink(progDir string, index int, a pkg.Attachment, prog *ebpf.Program, lnk pkg.Link) error {
+	progPath := programPinPath(progDir, a.Program)
+	if !prog.IsPinned() {
+		if err := replacePin(progPath, prog.Pin); err != nil {
+			return fmt.Errorf("failed to pin program '%s': %w", a.Program, err)
+		}
+		fmt.Printf("Program '%s' pinned to: %s\n", a.Program, progPath)
+	}
+
+	linkPath := linkPinPath(progDir, index, a.Program)
+	err := replacePin(linkPath, lnk.Pin)
+	if errors.Is(err, link.ErrNotSupported) {
+		fmt.Printf("Link of '%s' does not support pinning, it will be re-attached on restore\n", a.Program)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to pin link of '%s': %w", a.Program, err)
+	}
+	fmt.Printf("Link of '%s' pinned to: %s\n", a.Program, linkPath)
+	return nil
+}
+
+// replacePin removes a stale pin at path and pins a new object there
+func replacePin(path string, pin func(string) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return pin(path)
 }
 
 func netInterfaceByName(name string) (*net.Interface, error) {
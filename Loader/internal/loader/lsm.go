@@ -0,0 +1,51 @@
+package loader
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bearslyricattack/EBPForge/pkg"
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// lsmListPath lists the LSMs enabled in the running kernel
+const lsmListPath = "/sys/kernel/security/lsm"
+
+// attachLSM attaches a BPF-LSM program to the hook named in its section
+func attachLSM(prog *ebpf.Program) (pkg.Link, error) {
+	return link.AttachLSM(link.LSMOptions{Program: prog})
+}
+
+// checkBPFLSM fails unless the kernel was booted with the bpf LSM enabled
+func checkBPFLSM() error {
+	data, err := os.ReadFile(lsmListPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s, is securityfs mounted: %w", lsmListPath, err)
+	}
+	for _, lsm := range strings.Split(strings.TrimSpace(string(data)), ",") {
+		if lsm == "bpf" {
+			return nil
+		}
+	}
+	return fmt.Errorf("bpf LSM is not enabled (active LSMs: %s), add 'bpf' to the lsm= kernel boot parameter", strings.TrimSpace(string(data)))
+}
+
+// validateLSMSpec checks that the program is declared in an lsm/<hook> section,
+// that a given target names the same hook and that the kernel has the bpf LSM.
+// It runs before the collection is loaded, so nothing is created on kernels
+// that cannot run the program.
+func validateLSMSpec(spec *ebpf.ProgramSpec, args pkg.Attachment) error {
+	hook, ok := strings.CutPrefix(spec.SectionName, "lsm/")
+	if !ok {
+		hook, ok = strings.CutPrefix(spec.SectionName, "lsm.s/")
+	}
+	if !ok || hook == "" {
+		return fmt.Errorf("lsm program '%s' must be in a SEC(\"lsm/<hook>\") section, found %q", args.Program, spec.SectionName)
+	}
+	if args.Target != "" && args.Target != hook {
+		return fmt.Errorf("lsm target %s does not match section hook %s", args.Target, hook)
+	}
+	return checkBPFLSM()
+}
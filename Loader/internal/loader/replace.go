@@ -0,0 +1,159 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bearslyricattack/EBPForge/internal/registry"
+	"github.com/bearslyricattack/EBPForge/pkg"
+	"github.com/cilium/ebpf"
+	"golang.org/x/sys/unix"
+)
+
+// stagingDir holds the pins of a new instance of a program while the running
+// instance is still attached
+var stagingDir = filepath.Join(BPFFSPath, ".staging")
+
+// retiredDir holds the pins of a replaced instance until it is torn down
+var retiredDir = filepath.Join(BPFFSPath, ".retired")
+
+// Replace loads and attaches the object for the program named in args and
+// swaps it in for previous, which may be nil. previous keeps running until the
+// new object is attached with its pins in place, so a reload that fails leaves
+// the node running the old instance. Hooks that take a single program, like
+// XDP on an interface, refuse the second attachment; previous is then detached
+// first and attached again if the new object fails as well.
+// On success the pins of previous are moved aside and the caller tears it down.
+func Replace(previous *registry.Program, bpfObjectPath string, args pkg.AttachArgs) ([]pkg.Link, *ebpf.Collection, error) {
+	if previous == nil {
+		return LoadAndAttachBPF(bpfObjectPath, args)
+	}
+	staging := filepath.Join(stagingDir, args.Name)
+	// Left over by a Loader that died halfway through a replace
+	if err := os.RemoveAll(staging); err != nil {
+		return nil, nil, fmt.Errorf("failed to clear staging directory: %w", err)
+	}
+	detached := false
+	links, coll, err := loadAndAttach(bpfObjectPath, args, staging)
+	if errors.Is(err, unix.EBUSY) || errors.Is(err, unix.EEXIST) {
+		fmt.Printf("Hook of %s is held by the running instance, detaching it first\n", args.Name)
+		if err := detach(previous); err != nil {
+			return nil, nil, fmt.Errorf("failed to detach running instance: %w", err)
+		}
+		detached = true
+		links, coll, err = loadAndAttach(bpfObjectPath, args, staging)
+	}
+	if err == nil {
+		err = swapPins(previous, staging, PinDir(args.Name))
+		if err != nil {
+			os.RemoveAll(staging)
+			for _, lnk := range links {
+				lnk.Close()
+			}
+			coll.Close()
+		}
+	}
+	if err != nil {
+		if detached {
+			if rerr := reattach(previous); rerr != nil {
+				return nil, nil, fmt.Errorf("%w; the running instance could not be attached again: %v", err, rerr)
+			}
+		}
+		return nil, nil, err
+	}
+	forgetReplacedFilters(previous, links)
+	return links, coll, nil
+}
+
+// swapPins moves the pins of previous out of pinDir and the staged pins of
+// the new instance into it. previous is pointed at the moved pins, and keeps
+// its pins in place if the swap fails.
+func swapPins(previous *registry.Program, staging, pinDir string) error {
+	retired := filepath.Join(retiredDir, previous.Name)
+	if err := os.RemoveAll(retired); err != nil {
+		return fmt.Errorf("failed to clear retired directory: %w", err)
+	}
+	if err := os.MkdirAll(retiredDir, 0700); err != nil {
+		return fmt.Errorf("failed to create retired directory: %w", err)
+	}
+	if err := os.Rename(pinDir, retired); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to move pins of the running instance aside: %w", err)
+	}
+	if err := os.Rename(staging, pinDir); err != nil {
+		if rerr := os.Rename(retired, pinDir); rerr != nil && !os.IsNotExist(rerr) {
+			return fmt.Errorf("failed to move pins of the new instance into place: %w; pins of the running instance are left in %s: %v", err, retired, rerr)
+		}
+		return fmt.Errorf("failed to move pins of the new instance into place: %w", err)
+	}
+	previous.MovePins(retired)
+	return nil
+}
+
+// detach takes a running instance off its hooks, keeping its programs and maps open
+func detach(program *registry.Program) error {
+	var errs []error
+	for _, a := range program.Attachments {
+		if a.Link == nil {
+			continue
+		}
+		// A pinned link stays attached until its pin is gone
+		if a.LinkPinPath != "" {
+			if err := os.Remove(a.LinkPinPath); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, fmt.Errorf("failed to unpin link of '%s': %w", a.Program, err))
+				continue
+			}
+		}
+		if err := a.Link.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close link of '%s': %w", a.Program, err))
+			continue
+		}
+		a.Link = nil
+	}
+	return errors.Join(errs...)
+}
+
+// reattach attaches the programs of a detached instance to their hooks again
+func reattach(program *registry.Program) error {
+	if program.Collection == nil {
+		return errors.New("collection is not open")
+	}
+	for _, a := range program.Attachments {
+		if a.Link != nil {
+			continue
+		}
+		prog, ok := program.Collection.Programs[a.Program]
+		if !ok {
+			return fmt.Errorf("program '%s' is not open", a.Program)
+		}
+		lnk, err := Attach(prog, program.Name, a.Attachment)
+		if err != nil {
+			return fmt.Errorf("failed to attach '%s': %w", a.Program, err)
+		}
+		a.Link = lnk
+		if a.LinkPinPath != "" {
+			if err := replacePin(a.LinkPinPath, lnk.Pin); err != nil {
+				return fmt.Errorf("failed to pin link of '%s': %w", a.Program, err)
+			}
+		}
+	}
+	return nil
+}
+
+// forgetReplacedFilters drops the tc filters of previous that the new links
+// replaced in place, so tearing previous down does not delete them
+func forgetReplacedFilters(previous *registry.Program, links []pkg.Link) {
+	for _, a := range previous.Attachments {
+		old, ok := a.Link.(*tcFilter)
+		if !ok {
+			continue
+		}
+		for _, lnk := range links {
+			if f, ok := lnk.(*tcFilter); ok && old.sameSlot(f) {
+				a.Link = nil
+				break
+			}
+		}
+	}
+}
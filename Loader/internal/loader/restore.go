@@ -0,0 +1,126 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/bearslyricattack/EBPForge/internal/registry"
+	"github.com/bearslyricattack/EBPForge/pkg"
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/rlimit"
+)
+
+// Restore rebuilds the registry from the manifests left by a previous Loader process.
+// Pinned links are re-opened as is; programs whose link could not be pinned are
+// re-attached from the pinned program, and programs whose pins are gone entirely
+// (e.g. after a node reboot) are loaded again from their object file.
+func Restore() error {
+	// Replaced instances a previous process did not get to release stay attached through their pinned links
+	if err := os.RemoveAll(retiredDir); err != nil {
+		fmt.Printf("Failed to release replaced instances in %s: %v\n", retiredDir, err)
+	}
+	programs, err := registry.LoadManifests()
+	if err != nil {
+		return err
+	}
+	if len(programs) == 0 {
+		return nil
+	}
+	if err := rlimit.RemoveMemlock(); err != nil {
+		return fmt.Errorf("failed to remove MEMLOCK limit: %w", err)
+	}
+	for _, program := range programs {
+		if err := restoreProgram(program); err != nil {
+			fmt.Printf("Failed to restore program %s: %v\n", program.Name, err)
+			continue
+		}
+		registry.Add(program)
+		fmt.Printf("Restored program %s with %d attachment(s)\n", program.Name, len(program.Attachments))
+	}
+	return nil
+}
+
+func restoreProgram(program *registry.Program) error {
+	coll, err := openPinnedCollection(program)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("Pins of %s are missing, reloading from %s\n", program.Name, program.ObjectPath)
+		links, coll, err := LoadAndAttachBPF(program.ObjectPath, program.AttachArgs())
+		if err != nil {
+			return err
+		}
+		program.Collection = coll
+		for i, a := range program.Attachments {
+			a.Link = links[i]
+			a.ProgramPinPath = ProgramPinPath(program.Name, a.Program)
+			a.LinkPinPath = LinkPinPath(program.Name, i, a.Program)
+			if _, err := os.Stat(a.LinkPinPath); err != nil {
+				a.LinkPinPath = ""
+			}
+		}
+		return registry.SaveManifest(program)
+	}
+	if err != nil {
+		return err
+	}
+
+	links := make([]pkg.Link, 0, len(program.Attachments))
+	rollback := func() {
+		for _, lnk := range links {
+			lnk.Close()
+		}
+		coll.Close()
+	}
+	for _, a := range program.Attachments {
+		var lnk pkg.Link
+		if a.LinkPinPath != "" {
+			lnk, err = link.LoadPinnedLink(a.LinkPinPath, nil)
+		} else {
+			// The link died with the previous process, attach the pinned program again
+			lnk, err = Attach(coll.Programs[a.Program], program.Name, a.Attachment)
+		}
+		if err != nil {
+			rollback()
+			return fmt.Errorf("failed to restore link of '%s': %w", a.Program, err)
+		}
+		links = append(links, lnk)
+	}
+	for i, a := range program.Attachments {
+		a.Link = links[i]
+	}
+	program.Collection = coll
+	return nil
+}
+
+// openPinnedCollection opens the pinned programs and maps recorded in the manifest
+func openPinnedCollection(program *registry.Program) (*ebpf.Collection, error) {
+	coll := &ebpf.Collection{
+		Programs: make(map[string]*ebpf.Program),
+		Maps:     make(map[string]*ebpf.Map),
+	}
+	for _, a := range program.Attachments {
+		if _, ok := coll.Programs[a.Program]; ok {
+			continue
+		}
+		if a.ProgramPinPath == "" {
+			coll.Close()
+			return nil, fmt.Errorf("program '%s' was not pinned: %w", a.Program, os.ErrNotExist)
+		}
+		prog, err := ebpf.LoadPinnedProgram(a.ProgramPinPath, nil)
+		if err != nil {
+			coll.Close()
+			return nil, fmt.Errorf("failed to open pinned program '%s': %w", a.Program, err)
+		}
+		coll.Programs[a.Program] = prog
+	}
+	for mapName, mapPath := range program.MapPaths {
+		m, err := ebpf.LoadPinnedMap(mapPath, nil)
+		if err != nil {
+			coll.Close()
+			return nil, fmt.Errorf("failed to open pinned map '%s': %w", mapName, err)
+		}
+		coll.Maps[mapName] = m
+	}
+	return coll, nil
+}
@@ -0,0 +1,141 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bearslyricattack/EBPForge/pkg"
+	"github.com/cilium/ebpf"
+)
+
+// sectionAttachTypes maps ELF section prefixes to attach types.
+// More specific prefixes come first since the first match wins.
+var sectionAttachTypes = []struct {
+	prefix     string
+	attachType string
+}{
+	{"kprobe/", AttachKprobe},
+	{"kretprobe/", AttachKretprobe},
+	{"uprobe/", AttachUprobe},
+	{"uretprobe/", AttachUretprobe},
+	{"tracepoint/", AttachTracepoint},
+	{"tp/", AttachTracepoint},
+	{"raw_tracepoint/", AttachRawTracepoint},
+	{"raw_tp/", AttachRawTracepoint},
+	{"tp_btf/", AttachTpBTF},
+	{"fentry/", AttachFentry},
+	{"fentry.s/", AttachFentry},
+	{"fexit/", AttachFexit},
+	{"fexit.s/", AttachFexit},
+	{"fmod_ret/", AttachFmodRet},
+	{"fmod_ret.s/", AttachFmodRet},
+	{"lsm/", AttachLSM},
+	{"lsm.s/", AttachLSM},
+	{"xdp", AttachXDP},
+	{"tcx/", AttachTC},
+	{"tc", AttachTC},
+	{"classifier", AttachTC},
+	{"socket", AttachSockFilter},
+	{"cgroup/", AttachCgroup},
+	{"cgroup_skb/", AttachCgroup},
+	{"sockops", AttachCgroup},
+}
+
+// btfAttachTypes take their attach point from the section name at load time,
+// so the declared type has to agree with the section
+var btfAttachTypes = map[string]bool{
+	AttachFentry:  true,
+	AttachFexit:   true,
+	AttachFmodRet: true,
+	AttachTpBTF:   true,
+}
+
+// ResolveAttachArgs fills in the attach type and target of every attachment
+// from the program's ELF section when they are not given, and rejects
+// BTF-based attach types whose section disagrees with the requested type or target.
+// The returned args always carry the resolved list in Attachments.
+func ResolveAttachArgs(bpfObjectPath string, args pkg.AttachArgs) (pkg.AttachArgs, error) {
+	if len(args.Attachments) > 0 && (args.Program != "" || args.Ebpftype != "" || args.Target != "") {
+		return args, errors.New("set either program/type/target or attachments, not both")
+	}
+	spec, err := ebpf.LoadCollectionSpec(bpfObjectPath)
+	if err != nil {
+		return args, fmt.Errorf("failed to load eBPF object file: %w", err)
+	}
+	attachments := args.AttachmentList()
+	resolved := make([]pkg.Attachment, 0, len(attachments))
+	for _, a := range attachments {
+		a, err := resolveAttachment(spec, a)
+		if err != nil {
+			return args, err
+		}
+		resolved = append(resolved, a)
+	}
+	args.Attachments = resolved
+	return args, nil
+}
+
+func resolveAttachment(spec *ebpf.CollectionSpec, a pkg.Attachment) (pkg.Attachment, error) {
+	progSpec, ok := spec.Programs[a.Program]
+	if !ok {
+		available := make([]string, 0, len(spec.Programs))
+		for name := range spec.Programs {
+			available = append(available, name)
+		}
+		return a, fmt.Errorf("program '%s' not found, available: %v", a.Program, available)
+	}
+
+	sectionType, rest := attachTypeFromSection(progSpec.SectionName)
+	if a.Ebpftype == "" {
+		if sectionType == "" {
+			return a, fmt.Errorf("cannot infer attach type of '%s' from section %q, set the type explicitly", a.Program, progSpec.SectionName)
+		}
+		a.Ebpftype = sectionType
+		fmt.Printf("Inferred attach type %s of '%s' from section %s\n", a.Ebpftype, a.Program, progSpec.SectionName)
+	}
+	if btfAttachTypes[a.Ebpftype] && sectionType != a.Ebpftype {
+		return a, fmt.Errorf("%s program '%s' must be in a SEC(\"%s/<function>\") section, found %q",
+			a.Ebpftype, a.Program, a.Ebpftype, progSpec.SectionName)
+	}
+	if btfAttachTypes[a.Ebpftype] && a.Target != "" && a.Target != rest {
+		return a, fmt.Errorf("%s target %s does not match section hook %s, the attach point is taken from the section",
+			a.Ebpftype, a.Target, rest)
+	}
+	if a.Target == "" && sectionType == a.Ebpftype {
+		a.Target = targetFromSection(a.Ebpftype, rest)
+	}
+	if (a.Ebpftype == AttachCgroup || a.Ebpftype == AttachCgroupSock) && a.CgroupAttach == "" {
+		a.CgroupAttach = cgroupSectionAttach[progSpec.SectionName]
+		if a.CgroupAttach == "" && progSpec.SectionName == "cgroup/skb" {
+			return a, fmt.Errorf("cgroup program '%s' in section cgroup/skb needs cgroupAttach set to ingress or egress", a.Program)
+		}
+	}
+	return a, nil
+}
+
+// attachTypeFromSection returns the attach type a section name implies and
+// the part of the section after the matched prefix
+func attachTypeFromSection(section string) (string, string) {
+	for _, s := range sectionAttachTypes {
+		if rest, ok := strings.CutPrefix(section, s.prefix); ok {
+			return s.attachType, rest
+		}
+	}
+	return "", ""
+}
+
+// targetFromSection converts the remainder of a section name into a target
+// in the format Attach expects for the attach type
+func targetFromSection(attachType string, rest string) string {
+	switch attachType {
+	case AttachKprobe, AttachKretprobe, AttachRawTracepoint,
+		AttachFentry, AttachFexit, AttachFmodRet, AttachTpBTF, AttachLSM:
+		return rest
+	case AttachTracepoint:
+		// tracepoint/syscalls/sys_enter_execve -> syscalls:sys_enter_execve
+		return strings.Replace(rest, "/", ":", 1)
+	default:
+		return ""
+	}
+}
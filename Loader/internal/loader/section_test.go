@@ -0,0 +1,201 @@
+package loader
+
+import (
+	"testing"
+
+	"github.com/bearslyricattack/EBPForge/pkg"
+	"github.com/cilium/ebpf"
+)
+
+func TestAttachTypeFromSection(t *testing.T) {
+	tests := []struct {
+		section    string
+		attachType string
+		rest       string
+	}{
+		{"kprobe/do_unlinkat", AttachKprobe, "do_unlinkat"},
+		{"kretprobe/do_unlinkat", AttachKretprobe, "do_unlinkat"},
+		{"uprobe/readline", AttachUprobe, "readline"},
+		{"uretprobe/readline", AttachUretprobe, "readline"},
+		{"tracepoint/syscalls/sys_enter_execve", AttachTracepoint, "syscalls/sys_enter_execve"},
+		{"tp/sched/sched_switch", AttachTracepoint, "sched/sched_switch"},
+		{"tp_btf/sched_switch", AttachTpBTF, "sched_switch"},
+		{"raw_tracepoint/sys_enter", AttachRawTracepoint, "sys_enter"},
+		{"raw_tp/sys_enter", AttachRawTracepoint, "sys_enter"},
+		{"fentry/tcp_connect", AttachFentry, "tcp_connect"},
+		{"fentry.s/tcp_connect", AttachFentry, "tcp_connect"},
+		{"fexit/tcp_connect", AttachFexit, "tcp_connect"},
+		{"fexit.s/tcp_connect", AttachFexit, "tcp_connect"},
+		{"fmod_ret/security_file_open", AttachFmodRet, "security_file_open"},
+		{"fmod_ret.s/security_file_open", AttachFmodRet, "security_file_open"},
+		{"lsm/file_open", AttachLSM, "file_open"},
+		{"lsm.s/file_open", AttachLSM, "file_open"},
+		{"xdp", AttachXDP, ""},
+		{"xdp.frags", AttachXDP, ".frags"},
+		{"tcx/ingress", AttachTC, "ingress"},
+		{"tc", AttachTC, ""},
+		{"classifier", AttachTC, ""},
+		{"socket", AttachSockFilter, ""},
+		{"cgroup/connect4", AttachCgroup, "connect4"},
+		{"cgroup_skb/egress", AttachCgroup, "egress"},
+		{"sockops", AttachCgroup, ""},
+		{"perf_event", "", ""},
+		{".text", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.section, func(t *testing.T) {
+			attachType, rest := attachTypeFromSection(tt.section)
+			if attachType != tt.attachType || rest != tt.rest {
+				t.Errorf("attachTypeFromSection(%q) = %q, %q, want %q, %q", tt.section, attachType, rest, tt.attachType, tt.rest)
+			}
+		})
+	}
+}
+
+func TestTargetFromSection(t *testing.T) {
+	tests := []struct {
+		attachType string
+		rest       string
+		want       string
+	}{
+		{AttachKprobe, "do_unlinkat", "do_unlinkat"},
+		{AttachTracepoint, "syscalls/sys_enter_execve", "syscalls:sys_enter_execve"},
+		{AttachRawTracepoint, "sys_enter", "sys_enter"},
+		{AttachTpBTF, "sched_switch", "sched_switch"},
+		{AttachLSM, "file_open", "file_open"},
+		// Only the host knows which binary or interface these attach to
+		{AttachUprobe, "readline", ""},
+		{AttachTC, "ingress", ""},
+		{AttachCgroup, "connect4", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.attachType, func(t *testing.T) {
+			if got := targetFromSection(tt.attachType, tt.rest); got != tt.want {
+				t.Errorf("targetFromSection(%q, %q) = %q, want %q", tt.attachType, tt.rest, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveAttachment(t *testing.T) {
+	spec := &ebpf.CollectionSpec{Programs: map[string]*ebpf.ProgramSpec{
+		"trace_unlink":  {SectionName: "kprobe/do_unlinkat"},
+		"trace_exec":    {SectionName: "tracepoint/syscalls/sys_enter_execve"},
+		"trace_connect": {SectionName: "fentry/tcp_connect"},
+		"trace_switch":  {SectionName: "tp_btf/sched_switch"},
+		"deny_open":     {SectionName: "fmod_ret/security_file_open"},
+		"egress":        {SectionName: "cgroup_skb/egress"},
+		"skb":           {SectionName: "cgroup/skb"},
+		"readline":      {SectionName: "uprobe/readline"},
+		"perf":          {SectionName: "perf_event"},
+	}}
+	tests := []struct {
+		name    string
+		in      pkg.Attachment
+		want    pkg.Attachment
+		wantErr bool
+	}{
+		{
+			name: "type and target from section",
+			in:   pkg.Attachment{Program: "trace_unlink"},
+			want: pkg.Attachment{Program: "trace_unlink", Ebpftype: AttachKprobe, Target: "do_unlinkat"},
+		},
+		{
+			name: "tracepoint target",
+			in:   pkg.Attachment{Program: "trace_exec"},
+			want: pkg.Attachment{Program: "trace_exec", Ebpftype: AttachTracepoint, Target: "syscalls:sys_enter_execve"},
+		},
+		{
+			name: "explicit kprobe target",
+			in:   pkg.Attachment{Program: "trace_unlink", Ebpftype: AttachKprobe, Target: "vfs_unlink"},
+			want: pkg.Attachment{Program: "trace_unlink", Ebpftype: AttachKprobe, Target: "vfs_unlink"},
+		},
+		{
+			name: "explicit type of another section keeps the target",
+			in:   pkg.Attachment{Program: "trace_unlink", Ebpftype: AttachKretprobe, Target: "vfs_unlink"},
+			want: pkg.Attachment{Program: "trace_unlink", Ebpftype: AttachKretprobe, Target: "vfs_unlink"},
+		},
+		{
+			name: "fentry target from section",
+			in:   pkg.Attachment{Program: "trace_connect", Ebpftype: AttachFentry},
+			want: pkg.Attachment{Program: "trace_connect", Ebpftype: AttachFentry, Target: "tcp_connect"},
+		},
+		{
+			name: "fentry target matching section",
+			in:   pkg.Attachment{Program: "trace_connect", Target: "tcp_connect"},
+			want: pkg.Attachment{Program: "trace_connect", Ebpftype: AttachFentry, Target: "tcp_connect"},
+		},
+		{
+			name:    "fentry target differing from section",
+			in:      pkg.Attachment{Program: "trace_connect", Target: "tcp_close"},
+			wantErr: true,
+		},
+		{
+			name:    "tp_btf target differing from section",
+			in:      pkg.Attachment{Program: "trace_switch", Ebpftype: AttachTpBTF, Target: "sched_wakeup"},
+			wantErr: true,
+		},
+		{
+			name:    "fmod_ret target differing from section",
+			in:      pkg.Attachment{Program: "deny_open", Target: "security_file_permission"},
+			wantErr: true,
+		},
+		{
+			name:    "fexit declared for an fentry section",
+			in:      pkg.Attachment{Program: "trace_connect", Ebpftype: AttachFexit},
+			wantErr: true,
+		},
+		{
+			name:    "fentry declared for a kprobe section",
+			in:      pkg.Attachment{Program: "trace_unlink", Ebpftype: AttachFentry, Target: "do_unlinkat"},
+			wantErr: true,
+		},
+		{
+			name: "cgroup hook from section",
+			in:   pkg.Attachment{Program: "egress", Target: "/sys/fs/cgroup/app"},
+			want: pkg.Attachment{Program: "egress", Ebpftype: AttachCgroup, Target: "/sys/fs/cgroup/app", CgroupAttach: "egress"},
+		},
+		{
+			name:    "cgroup/skb without a direction",
+			in:      pkg.Attachment{Program: "skb", Target: "/sys/fs/cgroup/app"},
+			wantErr: true,
+		},
+		{
+			name: "cgroup/skb with an explicit direction",
+			in:   pkg.Attachment{Program: "skb", Target: "/sys/fs/cgroup/app", CgroupAttach: "egress"},
+			want: pkg.Attachment{Program: "skb", Ebpftype: AttachCgroup, Target: "/sys/fs/cgroup/app", CgroupAttach: "egress"},
+		},
+		{
+			name: "uprobe target is not inferred",
+			in:   pkg.Attachment{Program: "readline"},
+			want: pkg.Attachment{Program: "readline", Ebpftype: AttachUprobe},
+		},
+		{
+			name:    "section without attach type",
+			in:      pkg.Attachment{Program: "perf"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown program",
+			in:      pkg.Attachment{Program: "missing", Ebpftype: AttachKprobe},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveAttachment(spec, tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("resolveAttachment(%+v) = %+v, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveAttachment(%+v): %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveAttachment(%+v) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
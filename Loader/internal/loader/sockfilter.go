@@ -0,0 +1,128 @@
+package loader
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/bearslyricattack/EBPForge/pkg"
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"golang.org/x/sys/unix"
+)
+
+// sockFilterRcvBuf keeps the receive queue of the accounting socket tiny.
+// The filter runs before a packet is queued, so packets dropped on a full
+// queue have still been seen by the program.
+const sockFilterRcvBuf = 4096
+
+// sockFilter is a packet socket carrying a socket filter program.
+// The program stays attached for as long as the socket is open.
+type sockFilter struct {
+	fd int
+}
+
+// attachSockFilter opens a raw packet socket in the network namespace named
+// by the target and attaches prog to it. The target is "pod:<uid>",
+// "container:<id>", "pid:<pid>" or a network namespace path such as
+// /proc/<pid>/ns/net or /var/run/netns/<name>.
+func attachSockFilter(prog *ebpf.Program, args pkg.Attachment) (pkg.Link, error) {
+	nsPath, err := resolveNetnsPath(args.Target)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := packetSocketInNetns(nsPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, sockFilterRcvBuf); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to shrink socket receive buffer: %w", err)
+	}
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_ATTACH_BPF, prog.FD()); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to attach socket filter: %w", err)
+	}
+	return &sockFilter{fd: fd}, nil
+}
+
+// resolveNetnsPath turns a socket filter target into a network namespace file
+func resolveNetnsPath(target string) (string, error) {
+	var pid int
+	var err error
+	w, isWorkload := parseWorkload(target)
+	switch {
+	case isWorkload:
+		pid, err = processInCgroup(w)
+	case strings.HasPrefix(target, "pid:"):
+		pid, err = strconv.Atoi(strings.TrimPrefix(target, "pid:"))
+	case filepath.IsAbs(target):
+		return target, nil
+	default:
+		return "", errors.New("sockfilter target should be 'pod:<uid>', 'container:<id>', 'pid:<pid>' or a netns path")
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(procPath, strconv.Itoa(pid), "ns", "net"), nil
+}
+
+// packetSocketInNetns creates an AF_PACKET socket that lives in the given
+// network namespace. Sockets keep the namespace they were created in, so the
+// thread only has to switch namespaces for the socket call.
+func packetSocketInNetns(nsPath string) (int, error) {
+	target, err := unix.Open(nsPath, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("failed to open network namespace %s: %w", nsPath, err)
+	}
+	defer unix.Close(target)
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origin, err := unix.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()), unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("failed to open current network namespace: %w", err)
+	}
+	defer unix.Close(origin)
+
+	if err := unix.Setns(target, unix.CLONE_NEWNET); err != nil {
+		return -1, fmt.Errorf("failed to enter network namespace %s: %w", nsPath, err)
+	}
+	fd, sockErr := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW|unix.SOCK_CLOEXEC, int(htons(unix.ETH_P_ALL)))
+	if err := unix.Setns(origin, unix.CLONE_NEWNET); err != nil {
+		// The thread is stuck in the wrong namespace; leave it locked so the
+		// runtime terminates it instead of reusing it.
+		runtime.LockOSThread()
+		if sockErr == nil {
+			unix.Close(fd)
+		}
+		return -1, fmt.Errorf("failed to return to original network namespace: %w", err)
+	}
+	if sockErr != nil {
+		return -1, fmt.Errorf("failed to create packet socket: %w", sockErr)
+	}
+	return fd, nil
+}
+
+// htons converts a protocol number to network byte order
+func htons(v uint16) uint16 {
+	return binary.NativeEndian.Uint16(binary.BigEndian.AppendUint16(nil, v))
+}
+
+func (s *sockFilter) Pin(string) error {
+	return fmt.Errorf("socket filter pin: %w", link.ErrNotSupported)
+}
+
+func (s *sockFilter) Unpin() error {
+	return fmt.Errorf("socket filter unpin: %w", link.ErrNotSupported)
+}
+
+// Close closes the socket, which detaches the program
+func (s *sockFilter) Close() error {
+	return unix.Close(s.fd)
+}
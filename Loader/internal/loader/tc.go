@@ -0,0 +1,122 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/bearslyricattack/EBPForge/pkg"
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// attachTC attaches prog to the ingress or egress hook of an interface given
+// as "eth0:ingress" or "eth0:egress". TCX links are used where the kernel
+// supports them (6.6+); older kernels get a direct-action bpf filter on a
+// clsact qdisc instead.
+func attachTC(prog *ebpf.Program, name string, args pkg.Attachment) (pkg.Link, error) {
+	ifaceName, direction, ok := strings.Cut(args.Target, ":")
+	if !ok || ifaceName == "" {
+		return nil, errors.New("tc target format should be 'interface:ingress' or 'interface:egress'")
+	}
+	var attach ebpf.AttachType
+	var parent uint32
+	switch direction {
+	case "ingress":
+		attach, parent = ebpf.AttachTCXIngress, netlink.HANDLE_MIN_INGRESS
+	case "egress":
+		attach, parent = ebpf.AttachTCXEgress, netlink.HANDLE_MIN_EGRESS
+	default:
+		return nil, fmt.Errorf("tc direction must be 'ingress' or 'egress', got %q", direction)
+	}
+	iface, err := netInterfaceByName(ifaceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network interface: %w", err)
+	}
+
+	lnk, err := link.AttachTCX(link.TCXOptions{
+		Interface: iface.Index,
+		Program:   prog,
+		Attach:    attach,
+	})
+	if err == nil {
+		return lnk, nil
+	}
+	if !errors.Is(err, link.ErrNotSupported) {
+		return nil, err
+	}
+	fmt.Printf("TCX is not supported on this kernel, falling back to a clsact filter on %s\n", args.Target)
+	return attachTCFilter(prog, name+"/"+args.Program, iface.Index, parent)
+}
+
+// tcFilter is a bpf filter attached through netlink.
+// It has no bpf_link, so it cannot be pinned; the filter itself outlives the
+// Loader and is replaced in place when the program is attached again.
+type tcFilter struct {
+	filter *netlink.BpfFilter
+}
+
+func attachTCFilter(prog *ebpf.Program, name string, ifindex int, parent uint32) (*tcFilter, error) {
+	qdisc := &netlink.GenericQdisc{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: ifindex,
+			Handle:    netlink.MakeHandle(0xffff, 0),
+			Parent:    netlink.HANDLE_CLSACT,
+		},
+		QdiscType: "clsact",
+	}
+	if err := netlink.QdiscReplace(qdisc); err != nil {
+		return nil, fmt.Errorf("failed to set up clsact qdisc: %w", err)
+	}
+	filter := &netlink.BpfFilter{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: ifindex,
+			Parent:    parent,
+			Handle:    netlink.MakeHandle(0, 1),
+			Protocol:  unix.ETH_P_ALL,
+			Priority:  filterPriority(name),
+		},
+		Fd:           prog.FD(),
+		Name:         name,
+		DirectAction: true,
+	}
+	if err := netlink.FilterReplace(filter); err != nil {
+		return nil, fmt.Errorf("failed to attach tc filter: %w", err)
+	}
+	return &tcFilter{filter: filter}, nil
+}
+
+// filterPriority derives a stable filter priority from the filter name so
+// every attachment owns its own slot and re-attaching replaces the old filter
+func filterPriority(name string) uint16 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return uint16(h.Sum32()%0xff00) + 0x100
+}
+
+// sameSlot reports whether both filters occupy the same slot, in which case
+// attaching one replaced the other
+func (f *tcFilter) sameSlot(other *tcFilter) bool {
+	a, b := f.filter.FilterAttrs, other.filter.FilterAttrs
+	return a.LinkIndex == b.LinkIndex && a.Parent == b.Parent && a.Priority == b.Priority && a.Handle == b.Handle
+}
+
+func (f *tcFilter) Pin(string) error {
+	return fmt.Errorf("tc filter pin: %w", link.ErrNotSupported)
+}
+
+func (f *tcFilter) Unpin() error {
+	return fmt.Errorf("tc filter unpin: %w", link.ErrNotSupported)
+}
+
+// Close removes the filter. The clsact qdisc is left in place since other
+// programs may still have filters on it.
+func (f *tcFilter) Close() error {
+	if err := netlink.FilterDel(f.filter); err != nil && !errors.Is(err, unix.ENOENT) {
+		return fmt.Errorf("failed to remove tc filter: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package loader
+
+import (
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestFilterPriority(t *testing.T) {
+	names := []string{"drop/tc_ingress", "drop/tc_egress", "count/tc_ingress", "a/b"}
+	seen := make(map[uint16]string)
+	for _, name := range names {
+		priority := filterPriority(name)
+		if again := filterPriority(name); again != priority {
+			t.Errorf("priority of %s changed from %d to %d", name, priority, again)
+		}
+		// Priorities below 0x100 are left to filters set up by hand
+		if priority < 0x100 {
+			t.Errorf("priority of %s = %#x, below 0x100", name, priority)
+		}
+		if other, ok := seen[priority]; ok {
+			t.Errorf("%s and %s share priority %d", name, other, priority)
+		}
+		seen[priority] = name
+	}
+}
+
+func TestSameSlot(t *testing.T) {
+	filter := func(ifindex int, parent uint32, priority uint16) *tcFilter {
+		return &tcFilter{filter: &netlink.BpfFilter{FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: ifindex,
+			Parent:    parent,
+			Handle:    netlink.MakeHandle(0, 1),
+			Priority:  priority,
+		}}}
+	}
+	ingress := uint32(netlink.HANDLE_MIN_INGRESS)
+	egress := uint32(netlink.HANDLE_MIN_EGRESS)
+	priority := filterPriority("drop/tc_ingress")
+	base := filter(2, ingress, priority)
+	tests := []struct {
+		name  string
+		other *tcFilter
+		want  bool
+	}{
+		{"same slot", filter(2, ingress, priority), true},
+		{"other interface", filter(3, ingress, priority), false},
+		{"other direction", filter(2, egress, priority), false},
+		{"other priority", filter(2, ingress, filterPriority("count/tc_ingress")), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := base.sameSlot(tt.other); got != tt.want {
+				t.Errorf("sameSlot = %v, want %v", got, tt.want)
+			}
+			if got := tt.other.sameSlot(base); got != tt.want {
+				t.Errorf("reverse sameSlot = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
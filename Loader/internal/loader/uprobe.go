@@ -0,0 +1,123 @@
+package loader
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bearslyricattack/EBPForge/pkg"
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// procPath is where the host's procfs is mounted inside the Loader container
+const procPath = "/proc"
+
+// attachUprobe attaches prog to a userspace function described by a
+// "/path/to/binary:symbol[+offset]" target. When args.ContainerID is set the
+// binary path is resolved inside that container's mount namespace.
+func attachUprobe(prog *ebpf.Program, args pkg.Attachment, ret bool) (link.Link, error) {
+	binary, symbol, offset, err := parseUprobeTarget(args.Target)
+	if err != nil {
+		return nil, err
+	}
+	if args.ContainerID != "" {
+		binary, err = resolveContainerPath(args.ContainerID, args.Pid, binary)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ex, err := link.OpenExecutable(binary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open executable %s: %w", binary, err)
+	}
+	opts := &link.UprobeOptions{
+		Offset: offset,
+		PID:    args.Pid,
+	}
+	if ret {
+		return ex.Uretprobe(symbol, prog, opts)
+	}
+	return ex.Uprobe(symbol, prog, opts)
+}
+
+// parseUprobeTarget splits a "/path/to/binary:symbol[+offset]" target.
+// The offset may be decimal or 0x prefixed hexadecimal.
+func parseUprobeTarget(target string) (string, string, uint64, error) {
+	idx := strings.LastIndex(target, ":")
+	if idx <= 0 || idx == len(target)-1 {
+		return "", "", 0, errors.New("uprobe target format should be '/path/to/binary:symbol[+offset]'")
+	}
+	binary, symbol := target[:idx], target[idx+1:]
+	if !filepath.IsAbs(binary) {
+		return "", "", 0, fmt.Errorf("uprobe binary path must be absolute: %s", binary)
+	}
+	var offset uint64
+	if sym, off, ok := strings.Cut(symbol, "+"); ok {
+		parsed, err := strconv.ParseUint(off, 0, 64)
+		if err != nil {
+			return "", "", 0, fmt.Errorf("invalid uprobe offset %q: %w", off, err)
+		}
+		symbol, offset = sym, parsed
+	}
+	if symbol == "" {
+		return "", "", 0, errors.New("uprobe symbol must not be empty")
+	}
+	return binary, symbol, offset, nil
+}
+
+// resolveContainerPath maps a path inside a container to a host path through
+// the root of one of the container's processes. pid is used when non-zero,
+// otherwise a process is looked up by container ID.
+func resolveContainerPath(containerID string, pid int, path string) (string, error) {
+	if pid == 0 {
+		var err error
+		pid, err = processInCgroup(containerWorkload(containerID))
+		if err != nil {
+			return "", err
+		}
+	}
+	hostPath := filepath.Join(procPath, strconv.Itoa(pid), "root", path)
+	if _, err := os.Stat(hostPath); err != nil {
+		return "", fmt.Errorf("binary %s not found in container %s: %w", path, containerID, err)
+	}
+	return hostPath, nil
+}
+
+// processInCgroup returns the first process whose cgroup path belongs to the workload.
+// The Loader has to run in the host PID namespace for this to see container processes.
+func processInCgroup(w workload) (int, error) {
+	entries, err := os.ReadDir(procPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", procPath, err)
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if cgroupContains(filepath.Join(procPath, entry.Name(), "cgroup"), w) {
+			return pid, nil
+		}
+	}
+	return 0, fmt.Errorf("no process found for %s", w.what)
+}
+
+func cgroupContains(cgroupFile string, w workload) bool {
+	f, err := os.Open(cgroupFile)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if w.matches(scanner.Text()) {
+			return true
+		}
+	}
+	return false
+}
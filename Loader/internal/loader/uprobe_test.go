@@ -0,0 +1,48 @@
+package loader
+
+import "testing"
+
+func TestParseUprobeTarget(t *testing.T) {
+	tests := []struct {
+		target  string
+		binary  string
+		symbol  string
+		offset  uint64
+		wantErr bool
+	}{
+		{target: "/usr/bin/bash:readline", binary: "/usr/bin/bash", symbol: "readline"},
+		{target: "/usr/lib/libc.so.6:malloc+16", binary: "/usr/lib/libc.so.6", symbol: "malloc", offset: 16},
+		{target: "/usr/lib/libc.so.6:malloc+0x1a", binary: "/usr/lib/libc.so.6", symbol: "malloc", offset: 0x1a},
+		// The last colon separates the symbol, so paths may contain colons
+		{target: "/opt/app:v2/server:main.handle", binary: "/opt/app:v2/server", symbol: "main.handle"},
+		{target: "/usr/bin/bash", wantErr: true},
+		{target: "/usr/bin/bash:", wantErr: true},
+		{target: ":readline", wantErr: true},
+		{target: "bin/bash:readline", wantErr: true},
+		{target: "/usr/bin/bash:+16", wantErr: true},
+		{target: "/usr/bin/bash:readline+", wantErr: true},
+		{target: "/usr/bin/bash:readline+0xzz", wantErr: true},
+		{target: "/usr/bin/bash:readline+-1", wantErr: true},
+		// Containers are selected with containerId, not in the target
+		{target: "container:3f2a:/usr/bin/bash:readline", wantErr: true},
+		{target: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			binary, symbol, offset, err := parseUprobeTarget(tt.target)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseUprobeTarget(%q) = %q, %q, %d, want an error", tt.target, binary, symbol, offset)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseUprobeTarget(%q): %v", tt.target, err)
+			}
+			if binary != tt.binary || symbol != tt.symbol || offset != tt.offset {
+				t.Errorf("parseUprobeTarget(%q) = %q, %q, %d, want %q, %q, %d",
+					tt.target, binary, symbol, offset, tt.binary, tt.symbol, tt.offset)
+			}
+		})
+	}
+}
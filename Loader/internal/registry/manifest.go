@@ -0,0 +1,110 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StateDir holds one JSON manifest and a copy of the object per loaded program.
+// It cannot live on the BPF filesystem, which only accepts pinned objects.
+var StateDir = "/var/lib/ebpforge"
+
+// ManifestPath returns the manifest location of the named program
+func ManifestPath(name string) string {
+	return filepath.Join(StateDir, name+".json")
+}
+
+// ObjectPath returns where the object of the named program is kept for restores
+func ObjectPath(name string) string {
+	return filepath.Join(StateDir, name+".o")
+}
+
+// SaveObject copies a compiled object into StateDir, where the next compile of
+// the program cannot overwrite it, and returns the path of the copy
+func SaveObject(name string, objectPath string) (string, error) {
+	if err := os.MkdirAll(StateDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := os.ReadFile(objectPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read object: %w", err)
+	}
+	path := ObjectPath(name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write object: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("failed to write object: %w", err)
+	}
+	return path, nil
+}
+
+// SaveManifest persists the program description so it can be restored after a restart
+func SaveManifest(program *Program) error {
+	if err := os.MkdirAll(StateDir, 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(program, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	path := ManifestPath(program.Name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// RemoveManifest deletes the manifest and the saved object of the named program
+func RemoveManifest(name string) error {
+	if err := os.Remove(ManifestPath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove manifest: %w", err)
+	}
+	if err := os.Remove(ObjectPath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove saved object: %w", err)
+	}
+	return nil
+}
+
+// LoadManifests reads every manifest in StateDir.
+// The returned programs have no open link or collection.
+func LoadManifests() ([]*Program, error) {
+	entries, err := os.ReadDir(StateDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state directory: %w", err)
+	}
+	var programs []*Program
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(StateDir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest %s: %w", entry.Name(), err)
+		}
+		var program Program
+		if err := json.Unmarshal(data, &program); err != nil {
+			fmt.Printf("Skipping corrupt manifest %s: %v\n", entry.Name(), err)
+			continue
+		}
+		if len(program.Attachments) == 0 {
+			fmt.Printf("Skipping manifest %s without attachments\n", entry.Name())
+			continue
+		}
+		programs = append(programs, &program)
+	}
+	return programs, nil
+}
@@ -0,0 +1,189 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bearslyricattack/EBPForge/pkg"
+	"github.com/cilium/ebpf"
+)
+
+// Program describes an eBPF object loaded by the Loader and the programs of it that are attached.
+// The exported fields with json tags are persisted as the program's manifest.
+type Program struct {
+	Name        string            `json:"name"`        // Program name, also the pin directory name
+	ObjectPath  string            `json:"objectPath"`  // Compiled object file
+	SourceHash  string            `json:"sourceHash"`  // SHA-256 of the program source
+	PinDir      string            `json:"pinDir"`      // Pin directory under the BPF filesystem
+	MapPaths    map[string]string `json:"mapPaths"`    // Pinned map paths keyed by map name
+	Attachments []*Attachment     `json:"attachments"` // Attached programs sharing the maps
+	LoadedAt    time.Time         `json:"loadedAt"`    // Time the program was attached
+
+	Collection *ebpf.Collection `json:"-"`
+
+	// mu keeps Status from reading the collection while it is being closed
+	mu sync.RWMutex
+}
+
+// Attachment is one attached program of a Program
+type Attachment struct {
+	pkg.Attachment
+	ProgramPinPath string `json:"programPinPath"` // Pinned program, empty if not pinned
+	LinkPinPath    string `json:"linkPinPath"`    // Pinned link, empty if the link type cannot be pinned
+
+	Link pkg.Link `json:"-"`
+}
+
+// AttachArgs returns the arguments the program was attached with
+func (p *Program) AttachArgs() pkg.AttachArgs {
+	args := pkg.AttachArgs{Name: p.Name}
+	for _, a := range p.Attachments {
+		args.Attachments = append(args.Attachments, a.Attachment)
+	}
+	return args
+}
+
+// TeardownResult reports what was released when a program was torn down
+type TeardownResult struct {
+	Name             string   `json:"name"`
+	LinksClosed      []string `json:"linksClosed"`
+	CollectionClosed bool     `json:"collectionClosed"`
+	UnpinnedMaps     []string `json:"unpinnedMaps"`
+	PinDirRemoved    string   `json:"pinDirRemoved,omitempty"`
+}
+
+var (
+	programs = make(map[string]*Program)
+	lock     = sync.RWMutex{}
+)
+
+// Add registers a program and returns the entry it replaced, if any
+func Add(program *Program) *Program {
+	lock.Lock()
+	defer lock.Unlock()
+	previous := programs[program.Name]
+	programs[program.Name] = program
+	return previous
+}
+
+// Get returns the program registered under name
+func Get(name string) (*Program, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+	program, ok := programs[name]
+	return program, ok
+}
+
+// List returns all registered programs sorted by name
+func List() []*Program {
+	lock.RLock()
+	defer lock.RUnlock()
+	list := make([]*Program, 0, len(programs))
+	for _, p := range programs {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Remove deletes the program registered under name and returns it
+func Remove(name string) (*Program, bool) {
+	lock.Lock()
+	defer lock.Unlock()
+	program, ok := programs[name]
+	if ok {
+		delete(programs, name)
+	}
+	return program, ok
+}
+
+// Close detaches the links and closes the collection, leaving pinned objects in place
+func (p *Program) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var errs []error
+	for _, a := range p.Attachments {
+		if a.Link == nil {
+			continue
+		}
+		if err := a.Link.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close link of '%s': %w", a.Program, err))
+		}
+		a.Link = nil
+	}
+	if p.Collection != nil {
+		p.Collection.Close()
+		p.Collection = nil
+	}
+	return errors.Join(errs...)
+}
+
+// MovePins points p at its pins after its pin directory was moved to dir
+func (p *Program) MovePins(dir string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rebase := func(path string) string {
+		rel, err := filepath.Rel(p.PinDir, path)
+		if path == "" || err != nil {
+			return path
+		}
+		return filepath.Join(dir, rel)
+	}
+	for name, path := range p.MapPaths {
+		p.MapPaths[name] = rebase(path)
+	}
+	for _, a := range p.Attachments {
+		a.ProgramPinPath = rebase(a.ProgramPinPath)
+		a.LinkPinPath = rebase(a.LinkPinPath)
+	}
+	p.PinDir = dir
+}
+
+// Teardown detaches every attachment, closes its collection and removes its pin directory and manifest.
+// The manifest is kept when anything fails, so the program can still be found and torn down again.
+func (p *Program) Teardown() (*TeardownResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	result := &TeardownResult{Name: p.Name, LinksClosed: []string{}}
+	var errs []error
+	for _, a := range p.Attachments {
+		if a.Link == nil {
+			continue
+		}
+		if err := a.Link.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close link of '%s': %w", a.Program, err))
+			continue
+		}
+		result.LinksClosed = append(result.LinksClosed, a.Program)
+		a.Link = nil
+	}
+	if p.Collection != nil {
+		p.Collection.Close()
+		p.Collection = nil
+		result.CollectionClosed = true
+	}
+	for mapName, mapPath := range p.MapPaths {
+		if err := os.Remove(mapPath); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("failed to unpin map '%s': %w", mapName, err))
+			continue
+		}
+		result.UnpinnedMaps = append(result.UnpinnedMaps, mapPath)
+	}
+	sort.Strings(result.UnpinnedMaps)
+	if p.PinDir != "" {
+		if err := os.RemoveAll(p.PinDir); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove pin directory: %w", err))
+		} else {
+			result.PinDirRemoved = p.PinDir
+		}
+	}
+	if len(errs) > 0 {
+		return result, errors.Join(errs...)
+	}
+	return result, RemoveManifest(p.Name)
+}
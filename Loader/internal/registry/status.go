@@ -0,0 +1,107 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ProgramStatus is the kernel-side view of a registered program
+type ProgramStatus struct {
+	Name        string             `json:"name"`
+	ObjectPath  string             `json:"objectPath"`
+	SourceHash  string             `json:"sourceHash"`
+	LoadedAt    time.Time          `json:"loadedAt"`
+	Attachments []AttachmentStatus `json:"attachments"`
+	Maps        []MapStatus        `json:"maps"`
+	Errors      []string           `json:"errors,omitempty"`
+}
+
+// AttachmentStatus is the kernel-side view of one attached program
+type AttachmentStatus struct {
+	Program    string `json:"program"`
+	Type       string `json:"type"`
+	Target     string `json:"target"`
+	ProgramID  uint32 `json:"programId,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+	KernelType string `json:"kernelType,omitempty"`
+	LinkPinned bool   `json:"linkPinned"`
+}
+
+// MapStatus is the kernel-side view of a map owned by a registered program
+type MapStatus struct {
+	Name       string `json:"name"`
+	ID         uint32 `json:"id,omitempty"`
+	Type       string `json:"type"`
+	KeySize    uint32 `json:"keySize"`
+	ValueSize  uint32 `json:"valueSize"`
+	MaxEntries uint32 `json:"maxEntries"`
+	PinPath    string `json:"pinPath"`
+}
+
+// Status queries the kernel for the programs and maps of p.
+// Lookup failures are reported in Errors rather than failing the whole status.
+func (p *Program) Status() ProgramStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	status := ProgramStatus{
+		Name:        p.Name,
+		ObjectPath:  p.ObjectPath,
+		SourceHash:  p.SourceHash,
+		LoadedAt:    p.LoadedAt,
+		Attachments: []AttachmentStatus{},
+		Maps:        []MapStatus{},
+	}
+	for _, a := range p.Attachments {
+		status.Attachments = append(status.Attachments, AttachmentStatus{
+			Program:    a.Program,
+			Type:       a.Ebpftype,
+			Target:     a.Target,
+			LinkPinned: a.LinkPinPath != "",
+		})
+	}
+	if p.Collection == nil {
+		status.Errors = append(status.Errors, "collection is not open")
+		return status
+	}
+
+	for i := range status.Attachments {
+		as := &status.Attachments[i]
+		prog, ok := p.Collection.Programs[as.Program]
+		if !ok {
+			continue
+		}
+		info, err := prog.Info()
+		if err != nil {
+			status.Errors = append(status.Errors, fmt.Sprintf("program '%s' info: %v", as.Program, err))
+			continue
+		}
+		if id, ok := info.ID(); ok {
+			as.ProgramID = uint32(id)
+		}
+		as.Tag = info.Tag
+		as.KernelType = info.Type.String()
+	}
+
+	for mapName, m := range p.Collection.Maps {
+		ms := MapStatus{
+			Name:    mapName,
+			PinPath: p.MapPaths[mapName],
+		}
+		info, err := m.Info()
+		if err != nil {
+			status.Errors = append(status.Errors, fmt.Sprintf("map '%s' info: %v", mapName, err))
+		} else {
+			if id, ok := info.ID(); ok {
+				ms.ID = uint32(id)
+			}
+			ms.Type = info.Type.String()
+			ms.KeySize = info.KeySize
+			ms.ValueSize = info.ValueSize
+			ms.MaxEntries = info.MaxEntries
+		}
+		status.Maps = append(status.Maps, ms)
+	}
+	sort.Slice(status.Maps, func(i, j int) bool { return status.Maps[i].Name < status.Maps[j].Name })
+	return status
+}
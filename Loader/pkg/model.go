@@ -3,11 +3,66 @@ package pkg
 // AttachType defines the type of eBPF program attachment
 type AttachType string
 
-// AttachArgs contains parameters for eBPF program attachment
+// Link is an attachment of a program to its hook. cilium/ebpf links satisfy it;
+// attachments that are not backed by a bpf_link provide their own implementation
+// whose Pin returns an error wrapping link.ErrNotSupported.
+type Link interface {
+	Pin(fileName string) error
+	Unpin() error
+	Close() error
+}
+
+// AttachArgs contains parameters for eBPF program attachment.
+// A single attachment can be given inline through Program, Ebpftype and Target;
+// objects with several cooperating programs list them in Attachments instead.
 type AttachArgs struct {
-	Name     string // Program name
-	Ebpftype string // Attachment type
-	Target   string // Attachment target
-	Code     string // Program code
-	Program  string // Program section name
+	Name     string `json:"name"`    // Program name
+	Ebpftype string `json:"type"`    // Attachment type
+	Target   string `json:"target"`  // Attachment target
+	Code     string `json:"code"`    // Program code
+	Program  string `json:"program"` // Program section name
+
+	Pid         int    `json:"pid,omitempty"`         // Only fire uprobes for this process
+	ContainerID string `json:"containerId,omitempty"` // Resolve uprobe binary paths inside this container
+
+	CgroupAttach string `json:"cgroupAttach,omitempty"` // Cgroup hook such as ingress, egress, connect4 or sock_ops
+
+	Attachments []Attachment `json:"attachments,omitempty"` // Programs of the object to attach together
+}
+
+// Attachment describes where one program of an object is attached
+type Attachment struct {
+	Program      string `json:"program"`                // Program section name
+	Ebpftype     string `json:"type"`                   // Attachment type
+	Target       string `json:"target"`                 // Attachment target
+	Pid          int    `json:"pid,omitempty"`          // Only fire uprobes for this process
+	ContainerID  string `json:"containerId,omitempty"`  // Resolve uprobe binary paths inside this container
+	CgroupAttach string `json:"cgroupAttach,omitempty"` // Cgroup hook of cgroup programs
+}
+
+// AttachmentList returns the attachments of the request, turning the inline
+// single-program fields into a one element list when Attachments is empty
+func (a AttachArgs) AttachmentList() []Attachment {
+	if len(a.Attachments) > 0 {
+		return a.Attachments
+	}
+	return []Attachment{{
+		Program:      a.Program,
+		Ebpftype:     a.Ebpftype,
+		Target:       a.Target,
+		Pid:          a.Pid,
+		ContainerID:  a.ContainerID,
+		CgroupAttach: a.CgroupAttach,
+	}}
+}
+
+// LoadOptions controls how a load request is applied
+type LoadOptions struct {
+	Replace bool `json:"replace"` // Reload the program if one with the same name is already loaded
+}
+
+// LoadRequest is the body of POST /v1/programs
+type LoadRequest struct {
+	AttachArgs
+	Options LoadOptions `json:"options"`
 }